@@ -5,6 +5,7 @@ package order
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"sort"
 	"sync"
@@ -14,16 +15,22 @@ import (
 	"github.com/decred/dcrd/crypto/blake256"
 )
 
+// snapshotVersion is the encoding version prefixed to EpochQueue.Snapshot
+// output, bumped whenever the on-disk layout changes.
+const snapshotVersion = 0
+
 // EpochQueue represents a client epoch queue.
 type EpochQueue struct {
 	orders    map[order.OrderID]order.Commitment
+	commits   map[order.Commitment][]order.OrderID // inverse of orders, maintained alongside it
 	ordersMtx sync.Mutex
 }
 
 // NewEpochQueue creates a client epoch queue.
 func NewEpochQueue() *EpochQueue {
 	return &EpochQueue{
-		orders: make(map[order.OrderID]order.Commitment),
+		orders:  make(map[order.OrderID]order.Commitment),
+		commits: make(map[order.Commitment][]order.OrderID),
 	}
 }
 
@@ -31,6 +38,7 @@ func NewEpochQueue() *EpochQueue {
 func (eq *EpochQueue) Reset() {
 	eq.ordersMtx.Lock()
 	eq.orders = make(map[order.OrderID]order.Commitment)
+	eq.commits = make(map[order.Commitment][]order.OrderID)
 	eq.ordersMtx.Unlock()
 }
 
@@ -43,7 +51,16 @@ func (eq *EpochQueue) Enqueue(note *msgjson.EpochOrderNote) {
 	copy(commit[:], note.Commitment)
 
 	eq.ordersMtx.Lock()
+	// A re-enqueued order drops its previous commitment from the inverse
+	// map, so commits stays the inverse of orders.
+	if old, ok := eq.orders[oid]; ok {
+		eq.commits[old] = removeOID(eq.commits[old], oid)
+	}
 	eq.orders[oid] = commit
+	// Commitments are expected to be unique. A duplicate is still tracked
+	// here so GenerateMatchProof can detect it and fail, rather than
+	// guessing which of the orders sharing it a preimage belongs to.
+	eq.commits[commit] = append(eq.commits[commit], oid)
 	eq.ordersMtx.Unlock()
 }
 
@@ -62,68 +79,161 @@ func (eq *EpochQueue) Exists(oid order.OrderID) bool {
 	return ok
 }
 
+// orderPreimage pairs an enqueued order with the preimage that resolved
+// its commitment, the unit GenerateMatchProof sorts to build both the
+// seed and the commitment checksum.
+type orderPreimage struct {
+	oid    order.OrderID
+	commit order.Commitment
+	pimg   order.Preimage
+}
+
 // GenerateMatchProof calculates the sorting seed used in order matching as well
 // as the commitment checksum from the provided epoch queue preimages and
 // misses.
+//
+// Each preimage's blake256 hash is computed exactly once and looked up in
+// the commitment->orders inverse map maintained by Enqueue, so matching n
+// preimages against m outstanding commitments costs O(n) hashes instead of
+// the O(n*m) a naive preimages x orders scan would cost. A commitment
+// shared by more than one still-queued order is ambiguous - there is no
+// way to tell which of them the preimage belongs to - so it is left
+// unresolved, which fails the all-orders-matched check below exactly as
+// the original preimages x orders scan did.
 func (eq *EpochQueue) GenerateMatchProof(preimages []order.Preimage, misses []order.OrderID) ([]byte, []byte, error) {
 	eq.ordersMtx.Lock()
 	defer eq.ordersMtx.Unlock()
 
 	// Remove all misses.
 	for i := range misses {
-		delete(eq.orders, misses[i])
+		oid := misses[i]
+		if commit, ok := eq.orders[oid]; ok {
+			delete(eq.orders, oid)
+			eq.commits[commit] = removeOID(eq.commits[commit], oid)
+		}
 	}
 
-	// Map the preimages received with their associated epoch order ids.
-	orderPreimages := make(map[order.OrderID]order.Preimage, len(preimages))
+	// Resolve each preimage to its queued order by commitment, hashing the
+	// preimage only once. Commitments claimed by more than one order are
+	// skipped rather than guessed at.
+	pairs := make([]orderPreimage, 0, len(eq.orders))
 	for i := range preimages {
-		for oid, commit := range eq.orders {
-			commitment := blake256.Sum256(preimages[i][:])
-			if commit == commitment {
-				orderPreimages[oid] = preimages[i]
-				break
-			}
+		commitment := order.Commitment(blake256.Sum256(preimages[i][:]))
+		oids := eq.commits[commitment]
+		if len(oids) != 1 {
+			continue
+		}
+		pairs = append(pairs, orderPreimage{oids[0], commitment, preimages[i]})
+	}
+
+	// Sort by order ID, keeping one pair per order so a repeated preimage
+	// cannot stand in for an order that has none.
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(pairs[i].oid[:], pairs[j].oid[:]) < 0
+	})
+	uniq := pairs[:0]
+	for i := range pairs {
+		if n := len(uniq); n > 0 && uniq[n-1].oid == pairs[i].oid {
+			continue
 		}
+		uniq = append(uniq, pairs[i])
 	}
+	pairs = uniq
 
 	// Ensure all remaining epoch orders matched to a preimage.
-	if len(orderPreimages) != len(eq.orders) {
+	if len(pairs) != len(eq.orders) {
 		return nil, nil, fmt.Errorf("expected all remaining epoch orders (%v) "+
-			"matched to a preimage (%v)", len(orderPreimages), len(eq.orders))
+			"matched to a preimage (%v)", len(eq.orders), len(pairs))
 	}
 
-	// Extract the orders and commitments, and sort them.
-	oids := make([]order.OrderID, 0, len(eq.orders))
-	commits := make([]order.Commitment, 0, len(eq.orders))
-	for oid, commit := range eq.orders {
-		oids = append(oids, oid)
-		commits = append(commits, commit)
+	// Concatenate the preimages in order ID order to generate the seed.
+	sbuff := make([]byte, 0, len(pairs)*order.PreimageSize)
+	for i := range pairs {
+		sbuff = append(sbuff, pairs[i].pimg[:]...)
 	}
+	seed := blake256.Sum256(sbuff)
 
-	sort.Slice(oids, func(i, j int) bool {
-		return bytes.Compare(oids[i][:], oids[j][:]) < 0
+	// Re-sort the same pairs by commitment and concatenate the
+	// commitments in that order to generate the commitment checksum.
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(pairs[i].commit[:], pairs[j].commit[:]) < 0
 	})
+	cbuff := make([]byte, 0, len(pairs)*order.CommitmentSize)
+	for i := range pairs {
+		cbuff = append(cbuff, pairs[i].commit[:]...)
+	}
+	csum := blake256.Sum256(cbuff)
 
-	sort.Slice(commits, func(i, j int) bool {
-		return bytes.Compare(commits[i][:], commits[j][:]) < 0
-	})
+	return seed[:], csum[:], nil
+}
 
-	// Concatenate all preimages per the seed sort index and generate the
-	// seed.
-	sbuff := make([]byte, 0, len(oids)*order.PreimageSize)
-	for i := range oids {
-		pimg := orderPreimages[oids[i]]
-		sbuff = append(sbuff, pimg[:]...)
+// removeOID returns oids with oid removed, preserving the order of the
+// remaining elements.
+func removeOID(oids []order.OrderID, oid order.OrderID) []order.OrderID {
+	for i, o := range oids {
+		if o == oid {
+			return append(oids[:i], oids[i+1:]...)
+		}
 	}
-	seed := blake256.Sum256(sbuff)
+	return oids
+}
 
-	// Concatenate all order commitments per the commitment sort index and
-	// generate the commitment checksum.
-	cbuff := make([]byte, 0, len(eq.orders)*order.CommitmentSize)
-	for _, commit := range commits {
-		cbuff = append(cbuff, commit[:]...)
+// Snapshot serializes the currently enqueued orders so they can be
+// persisted across a restart and later restored with Restore. The format
+// is a version byte followed by a 4-byte order count and, for each order,
+// its 32-byte order ID and 32-byte commitment.
+func (eq *EpochQueue) Snapshot() ([]byte, error) {
+	eq.ordersMtx.Lock()
+	defer eq.ordersMtx.Unlock()
+
+	buf := make([]byte, 1, 1+4+len(eq.orders)*(order.OrderIDSize+order.CommitmentSize))
+	buf[0] = snapshotVersion
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(eq.orders)))
+	for oid, commit := range eq.orders {
+		buf = append(buf, oid[:]...)
+		buf = append(buf, commit[:]...)
 	}
-	csum := blake256.Sum256(cbuff)
+	return buf, nil
+}
 
-	return seed[:], csum[:], nil
+// Restore replaces the epoch queue's contents with the orders encoded in b,
+// as produced by Snapshot. It is intended to be called once at startup,
+// before any new epoch notes are enqueued, to recover in-progress epoch
+// commitments lost to a restart.
+func (eq *EpochQueue) Restore(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("snapshot too short")
+	}
+	if ver := b[0]; ver != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", ver)
+	}
+	b = b[1:]
+	if len(b) < 4 {
+		return fmt.Errorf("snapshot missing order count")
+	}
+	n := binary.BigEndian.Uint32(b)
+	b = b[4:]
+
+	const entrySize = order.OrderIDSize + order.CommitmentSize
+	if len(b) != int(n)*entrySize {
+		return fmt.Errorf("snapshot has %d bytes, expected %d for %d orders", len(b), int(n)*entrySize, n)
+	}
+
+	orders := make(map[order.OrderID]order.Commitment, n)
+	commits := make(map[order.Commitment][]order.OrderID, n)
+	for i := uint32(0); i < n; i++ {
+		entry := b[int(i)*entrySize:]
+		var oid order.OrderID
+		var commit order.Commitment
+		copy(oid[:], entry[:order.OrderIDSize])
+		copy(commit[:], entry[order.OrderIDSize:entrySize])
+		orders[oid] = commit
+		commits[commit] = append(commits[commit], oid)
+	}
+
+	eq.ordersMtx.Lock()
+	eq.orders = orders
+	eq.commits = commits
+	eq.ordersMtx.Unlock()
+	return nil
 }
@@ -202,3 +202,68 @@ func TestEpochQueue(t *testing.T) {
 			expectedCmtChecksum, cmtChecksum)
 	}
 }
+
+func TestEpochQueueSnapshotRestore(t *testing.T) {
+	mid := "mkt"
+	eq := NewEpochQueue()
+	for i := 0; i < 5; i++ {
+		pimg := randPreimage()
+		oid := randOrderID()
+		eq.Enqueue(makeEpochOrderNote(mid, msgjson.BuyOrderNum, oid, uint64(i), 1, makeCommitment(pimg)))
+	}
+
+	snap, err := eq.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	restored := NewEpochQueue()
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	if restored.Size() != eq.Size() {
+		t.Fatalf("expected restored size %d, got %d", eq.Size(), restored.Size())
+	}
+
+	eq.ordersMtx.Lock()
+	for oid, commit := range eq.orders {
+		restored.ordersMtx.Lock()
+		gotCommit, ok := restored.orders[oid]
+		restored.ordersMtx.Unlock()
+		if !ok {
+			t.Fatalf("restored queue missing order %x", oid)
+		}
+		if gotCommit != commit {
+			t.Fatalf("order %x: expected commitment %x, got %x", oid, commit, gotCommit)
+		}
+	}
+	eq.ordersMtx.Unlock()
+}
+
+func TestEpochQueueRestoreBadVersion(t *testing.T) {
+	eq := NewEpochQueue()
+	if err := eq.Restore([]byte{0xff, 0, 0, 0, 0}); err == nil {
+		t.Fatal("expected error restoring snapshot with unsupported version")
+	}
+}
+
+func TestEpochQueueDuplicateCommitment(t *testing.T) {
+	mid := "mkt"
+	eq := NewEpochQueue()
+
+	pimg := [32]byte{'1'}
+	commit := makeCommitment(pimg)
+	oidA := [32]byte{'a'}
+	oidB := [32]byte{'b'}
+	eq.Enqueue(makeEpochOrderNote(mid, msgjson.BuyOrderNum, oidA, 1, 1, commit))
+	eq.Enqueue(makeEpochOrderNote(mid, msgjson.BuyOrderNum, oidB, 2, 2, commit))
+
+	// A commitment shared by two orders is ambiguous: there is no way to
+	// tell which order the preimage belongs to, so this must fail rather
+	// than guess.
+	_, _, err := eq.GenerateMatchProof([]order.Preimage{pimg}, nil)
+	if err == nil {
+		t.Fatal("expected an error for a commitment shared by two orders")
+	}
+}
@@ -0,0 +1,192 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package asset
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BlockTimeSource is the subset of a Backend needed to bootstrap a
+// BlockTimeMonitor's sample window from chain history, e.g.
+// *btc.Backend.BlockTimeStamp.
+type BlockTimeSource interface {
+	BestBlockHeight() (int64, error)
+	BlockTimeStamp(height int64) (time.Time, error)
+}
+
+// blockTimeMonitorSnapshotVersion is the encoding version for
+// BlockTimeMonitor.Snapshot output.
+const blockTimeMonitorSnapshotVersion = 0
+
+// BlockTimeMonitor tracks a rolling distribution of the time it takes a
+// chain to produce `stretch` consecutive blocks, and uses that
+// distribution to recommend a confirmation requirement for a target
+// settling time. A chain producing blocks unusually fast should require
+// more confirmations to reach the same wall-clock assurance; a chain
+// going through a long gap should require fewer.
+type BlockTimeMonitor struct {
+	stretch    int
+	windowSize int
+
+	mtx       sync.RWMutex
+	heights   []int64         // block heights backing times, oldest first
+	times     []time.Time     // parallel to heights
+	stretches []time.Duration // observed N-block stretch durations, oldest first
+}
+
+// NewBlockTimeMonitor creates a BlockTimeMonitor that measures the time to
+// produce `stretch` blocks, keeping at most windowSize of the most recent
+// stretch samples.
+func NewBlockTimeMonitor(stretch, windowSize int) *BlockTimeMonitor {
+	return &BlockTimeMonitor{
+		stretch:    stretch,
+		windowSize: windowSize,
+	}
+}
+
+// Sample feeds a newly observed block into the monitor. height must be
+// provided in increasing order; out-of-order or duplicate heights are
+// ignored.
+func (m *BlockTimeMonitor) Sample(height int64, ts time.Time) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if n := len(m.heights); n > 0 && height <= m.heights[n-1] {
+		return
+	}
+
+	m.heights = append(m.heights, height)
+	m.times = append(m.times, ts)
+
+	if len(m.heights) > m.stretch {
+		i := len(m.heights) - 1 - m.stretch
+		stretchDur := m.times[len(m.times)-1].Sub(m.times[i])
+		m.stretches = append(m.stretches, stretchDur)
+		if len(m.stretches) > m.windowSize {
+			m.stretches = m.stretches[len(m.stretches)-m.windowSize:]
+		}
+	}
+
+	// Retain just enough history to compute the next stretch.
+	if keep := m.stretch + 1; len(m.heights) > keep {
+		trim := len(m.heights) - keep
+		m.heights = m.heights[trim:]
+		m.times = m.times[trim:]
+	}
+}
+
+// Bootstrap seeds the monitor's sample window by walking src's block
+// times from its current best height back depth blocks. It is intended to
+// be called once at startup so RequiredConfs has useful data immediately,
+// rather than waiting for windowSize new blocks to be observed live.
+func (m *BlockTimeMonitor) Bootstrap(src BlockTimeSource, depth int64) error {
+	best, err := src.BestBlockHeight()
+	if err != nil {
+		return fmt.Errorf("BestBlockHeight: %w", err)
+	}
+	first := best - depth
+	if first < 0 {
+		first = 0
+	}
+	for h := first; h <= best; h++ {
+		ts, err := src.BlockTimeStamp(h)
+		if err != nil {
+			return fmt.Errorf("BlockTimeStamp(%d): %w", h, err)
+		}
+		m.Sample(h, ts)
+	}
+	return nil
+}
+
+// RequiredConfs returns the number of confirmations such that, based on
+// the observed stretch-duration distribution, a chain is expected to take
+// at least `target` wall-clock time to produce that many blocks. It scales
+// the median observed per-block time by the stretch size and by how target
+// compares to it, with a floor of 1 confirmation.
+func (m *BlockTimeMonitor) RequiredConfs(target time.Duration) uint32 {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	if len(m.stretches) == 0 {
+		return 1
+	}
+
+	sorted := make([]time.Duration, len(m.stretches))
+	copy(sorted, m.stretches)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+	if median <= 0 {
+		return 1
+	}
+
+	perBlock := median / time.Duration(m.stretch)
+	if perBlock <= 0 {
+		return 1
+	}
+
+	confs := int64(target/perBlock) + 1
+	if confs < 1 {
+		confs = 1
+	}
+	return uint32(confs)
+}
+
+// Snapshot serializes the monitor's current stretch-duration window so it
+// can be persisted across a restart and restored without a full
+// Bootstrap. The format is a version byte, the stretch and window size,
+// a 4-byte sample count, and each sample as an 8-byte big-endian
+// nanosecond duration.
+func (m *BlockTimeMonitor) Snapshot() ([]byte, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	buf := []byte{blockTimeMonitorSnapshotVersion}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(m.stretch))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(m.windowSize))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(m.stretches)))
+	for _, d := range m.stretches {
+		buf = binary.BigEndian.AppendUint64(buf, uint64(d))
+	}
+	return buf, nil
+}
+
+// Restore replaces the monitor's sample window with the one encoded in b,
+// as produced by Snapshot.
+func (m *BlockTimeMonitor) Restore(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("snapshot too short")
+	}
+	if ver := b[0]; ver != blockTimeMonitorSnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", ver)
+	}
+	b = b[1:]
+	if len(b) < 12 {
+		return fmt.Errorf("snapshot missing header")
+	}
+	stretch := binary.BigEndian.Uint32(b)
+	windowSize := binary.BigEndian.Uint32(b[4:])
+	n := binary.BigEndian.Uint32(b[8:])
+	b = b[12:]
+	if uint32(len(b)) != n*8 {
+		return fmt.Errorf("snapshot has %d bytes, expected %d for %d samples", len(b), n*8, n)
+	}
+
+	stretches := make([]time.Duration, n)
+	for i := uint32(0); i < n; i++ {
+		stretches[i] = time.Duration(binary.BigEndian.Uint64(b[i*8:]))
+	}
+
+	m.mtx.Lock()
+	m.stretch = int(stretch)
+	m.windowSize = int(windowSize)
+	m.stretches = stretches
+	m.heights = nil
+	m.times = nil
+	m.mtx.Unlock()
+	return nil
+}
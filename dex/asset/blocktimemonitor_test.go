@@ -0,0 +1,56 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package asset
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlockTimeMonitorRequiredConfs(t *testing.T) {
+	m := NewBlockTimeMonitor(8, 20)
+	start := time.Unix(1700000000, 0)
+	for i := int64(0); i < 100; i++ {
+		// 10 minute blocks.
+		m.Sample(i, start.Add(time.Duration(i)*10*time.Minute))
+	}
+
+	confs := m.RequiredConfs(time.Hour)
+	if confs == 0 {
+		t.Fatal("expected a positive confirmation requirement")
+	}
+	// At ~10 min/block, an hour should need roughly 6-7 confs.
+	if confs < 5 || confs > 8 {
+		t.Fatalf("expected confs in [5,8] for 10 min blocks and a 1hr target, got %d", confs)
+	}
+}
+
+func TestBlockTimeMonitorSnapshotRestore(t *testing.T) {
+	m := NewBlockTimeMonitor(8, 20)
+	start := time.Unix(1700000000, 0)
+	for i := int64(0); i < 50; i++ {
+		m.Sample(i, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	snap, err := m.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	restored := NewBlockTimeMonitor(1, 1)
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	if got, want := restored.RequiredConfs(time.Hour), m.RequiredConfs(time.Hour); got != want {
+		t.Fatalf("expected restored RequiredConfs %d, got %d", want, got)
+	}
+}
+
+func TestBlockTimeMonitorNoSamples(t *testing.T) {
+	m := NewBlockTimeMonitor(8, 20)
+	if confs := m.RequiredConfs(time.Hour); confs != 1 {
+		t.Fatalf("expected floor of 1 confirmation with no samples, got %d", confs)
+	}
+}
@@ -0,0 +1,180 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+// Command genvectors generates the checked-in EpochQueue conformance
+// corpus from a seeded RNG and writes the result to -out (default
+// ../../testdata, the corpus directory when run from this command's
+// directory). Re-run it whenever a new class of
+// edge case needs coverage; existing vector files are overwritten in
+// place, so review the diff before committing.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+
+	clientorder "decred.org/dcrdex/client/order"
+	"decred.org/dcrdex/dex/msgjson"
+	"decred.org/dcrdex/dex/order"
+	"decred.org/dcrdex/dex/order/conformance"
+	"github.com/decred/dcrd/crypto/blake256"
+)
+
+func toOrderIDs(a [][32]byte) []order.OrderID {
+	out := make([]order.OrderID, len(a))
+	for i := range a {
+		out[i] = order.OrderID(a[i])
+	}
+	return out
+}
+
+func toCommitments(a [][32]byte) []order.Commitment {
+	out := make([]order.Commitment, len(a))
+	for i := range a {
+		out[i] = order.Commitment(a[i])
+	}
+	return out
+}
+
+func toPreimages(a [][32]byte) []order.Preimage {
+	out := make([]order.Preimage, len(a))
+	for i := range a {
+		out[i] = order.Preimage(a[i])
+	}
+	return out
+}
+
+var (
+	seed = flag.Int64("seed", 42, "seed for the deterministic RNG")
+	out  = flag.String("out", "../../testdata", "output directory for generated vector files")
+)
+
+func randOrderID(rnd *rand.Rand) (oid [32]byte) {
+	rnd.Read(oid[:])
+	return
+}
+
+func randPreimage(rnd *rand.Rand) (pi [32]byte) {
+	rnd.Read(pi[:])
+	return
+}
+
+// genVector builds a single vector of size n, optionally forcing a
+// duplicate commitment (dupe) and reserving numMisses orders with no
+// preimage. The expected seed and checksum are computed by actually
+// driving client/order.EpochQueue — the reference implementation this
+// corpus exists to pin — rather than a hand-rolled reimplementation of its
+// sort/hash construction, so a regression in the reference algorithm
+// shows up as a vector diff instead of silently passing.
+func genVector(name string, rnd *rand.Rand, n, numMisses int, dupe bool) (*conformance.Vector, error) {
+	oids := make([][32]byte, n)
+	preimages := make([][32]byte, n)
+	commits := make([][32]byte, n)
+	for i := 0; i < n; i++ {
+		oids[i] = randOrderID(rnd)
+		preimages[i] = randPreimage(rnd)
+		commits[i] = blake256.Sum256(preimages[i][:])
+	}
+	missSet := make(map[int]bool, numMisses+1)
+	if dupe && n >= 2 {
+		// Force orders 0 and 1 to share a commitment/preimage, as could
+		// occur if a client reused a preimage. A commitment shared by two
+		// still-queued orders is ambiguous and GenerateMatchProof rejects
+		// it, so order 1 is also forced to miss, leaving order 0 as the
+		// sole live claimant of the shared commitment.
+		preimages[1] = preimages[0]
+		commits[1] = commits[0]
+		missSet[1] = true
+	}
+
+	enqueueOrder := rnd.Perm(n)
+
+	target := len(missSet) + numMisses
+	misses := make([]int, 0, target)
+	for idx := range missSet {
+		misses = append(misses, idx)
+	}
+	for len(misses) < target && len(misses) < n {
+		idx := rnd.Intn(n)
+		if missSet[idx] {
+			continue
+		}
+		missSet[idx] = true
+		misses = append(misses, idx)
+	}
+	sort.Ints(misses)
+
+	eq := clientorder.NewEpochQueue()
+	for _, idx := range enqueueOrder {
+		eq.Enqueue(&msgjson.EpochOrderNote{OrderID: oids[idx][:], Commitment: commits[idx][:]})
+	}
+
+	missOIDs := make([]order.OrderID, len(misses))
+	for i, idx := range misses {
+		missOIDs[i] = order.OrderID(oids[idx])
+	}
+	remPreimages := toPreimages(remAllPreimages(preimages, missSet, n))
+
+	seedBytes, csumBytes, err := eq.GenerateMatchProof(remPreimages, missOIDs)
+	if err != nil {
+		return nil, fmt.Errorf("GenerateMatchProof: %w", err)
+	}
+
+	v := &conformance.Vector{
+		Name:             name,
+		OrderIDs:         toOrderIDs(oids),
+		Commitments:      toCommitments(commits),
+		Preimages:        toPreimages(remAllPreimages(preimages, missSet, n)),
+		EnqueueOrder:     enqueueOrder,
+		Misses:           misses,
+		ExpectedSeed:     seedBytes,
+		ExpectedChecksum: csumBytes,
+	}
+	return v, nil
+}
+
+// remAllPreimages returns only the preimages of orders that are not
+// misses, in order index order, matching what a real client would
+// broadcast.
+func remAllPreimages(preimages [][32]byte, missSet map[int]bool, n int) [][32]byte {
+	out := make([][32]byte, 0, n)
+	for i := 0; i < n; i++ {
+		if missSet[i] {
+			continue
+		}
+		out = append(out, preimages[i])
+	}
+	return out
+}
+
+func main() {
+	flag.Parse()
+	rnd := rand.New(rand.NewSource(*seed))
+
+	specs := []struct {
+		name      string
+		n, misses int
+		dupe      bool
+	}{
+		{"empty-queue", 0, 0, false},
+		{"single-order", 1, 0, false},
+		{"all-miss-epoch", 5, 5, false},
+		{"duplicate-commitments", 6, 0, true},
+		{"typical-epoch", 64, 3, false},
+		{"large-epoch", 500, 25, false},
+	}
+
+	for _, s := range specs {
+		v, err := genVector(s.name, rnd, s.n, s.misses, s.dupe)
+		if err != nil {
+			log.Fatalf("generating vector %q: %v", s.name, err)
+		}
+		if err := conformance.WriteVector(*out, v); err != nil {
+			log.Fatalf("writing vector %q: %v", v.Name, err)
+		}
+		fmt.Printf("wrote %s (%d orders, %d misses)\n", v.Name, len(v.OrderIDs), len(v.Misses))
+	}
+}
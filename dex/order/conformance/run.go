@@ -0,0 +1,114 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package conformance
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"testing"
+
+	"decred.org/dcrdex/dex/msgjson"
+	"decred.org/dcrdex/dex/order"
+)
+
+// skipConformance lets CI or a local developer opt out of the (slower,
+// exhaustive) conformance corpus while still running the regular unit
+// tests, e.g. `go test ./dex/order/conformance -args -skip-conformance`.
+// The flag is defined only in test binaries that import this package.
+var skipConformance = flag.Bool("skip-conformance", false, "skip the EpochQueue conformance vector corpus")
+
+// EpochQueue is the minimal surface every EpochQueue implementation
+// (reference client/order, or a third-party port) must expose to be
+// checked against the corpus. Enqueue takes the same *msgjson.EpochOrderNote
+// client/order.EpochQueue does, rather than a decoded order ID/commitment
+// pair, so the corpus exercises the real wire-note decoding path too.
+type EpochQueue interface {
+	Reset()
+	Enqueue(note *msgjson.EpochOrderNote)
+	GenerateMatchProof(preimages []order.Preimage, misses []order.OrderID) ([]byte, []byte, error)
+}
+
+// NewEpochQueueFunc constructs a fresh, empty implementation under test.
+// Run calls it once per vector so state never leaks between vectors.
+type NewEpochQueueFunc func() EpochQueue
+
+// noteFor builds the *msgjson.EpochOrderNote Enqueue expects for the
+// order at idx in v.
+func noteFor(v *Vector, idx int) *msgjson.EpochOrderNote {
+	oid := v.OrderIDs[idx]
+	commit := v.Commitments[idx]
+	return &msgjson.EpochOrderNote{OrderID: oid[:], Commitment: commit[:]}
+}
+
+// Run drives every vector in corpus against a fresh EpochQueue returned by
+// newQueue, failing t if any implementation diverges from the recorded
+// seed or commitment checksum. It is intended to be called from a regular
+// *_test.go file:
+//
+//	func TestConformance(t *testing.T) {
+//	    corpus, err := conformance.LoadCorpus("testdata")
+//	    ...
+//	    conformance.Run(t, corpus, func() conformance.EpochQueue { return clientorder.NewEpochQueue() })
+//	}
+//
+// where clientorder is "decred.org/dcrdex/client/order", the reference
+// implementation this corpus is generated against.
+func Run(t *testing.T, corpus Corpus, newQueue NewEpochQueueFunc) {
+	t.Helper()
+	if *skipConformance {
+		t.Skip("-skip-conformance set")
+	}
+	for _, v := range corpus {
+		v := v
+		t.Run(v.Name, func(t *testing.T) {
+			eq := newQueue()
+			for _, idx := range v.EnqueueOrder {
+				eq.Enqueue(noteFor(v, idx))
+			}
+
+			misses := make([]order.OrderID, len(v.Misses))
+			for i, idx := range v.Misses {
+				misses[i] = v.OrderIDs[idx]
+			}
+
+			seed, csum, err := eq.GenerateMatchProof(v.Preimages, misses)
+			if err != nil {
+				t.Fatalf("GenerateMatchProof: %v", err)
+			}
+			if !bytes.Equal(seed, v.ExpectedSeed) {
+				t.Errorf("seed mismatch: expected %x, got %x", v.ExpectedSeed, seed)
+			}
+			if !bytes.Equal(csum, v.ExpectedChecksum) {
+				t.Errorf("commitment checksum mismatch: expected %x, got %x", v.ExpectedChecksum, csum)
+			}
+		})
+	}
+}
+
+// Verify is a non-testing.T variant of Run suitable for use outside of `go
+// test`, e.g. by a generator command checking its own output round-trips.
+func Verify(corpus Corpus, newQueue NewEpochQueueFunc) error {
+	for _, v := range corpus {
+		eq := newQueue()
+		for _, idx := range v.EnqueueOrder {
+			eq.Enqueue(noteFor(v, idx))
+		}
+		misses := make([]order.OrderID, len(v.Misses))
+		for i, idx := range v.Misses {
+			misses[i] = v.OrderIDs[idx]
+		}
+		seed, csum, err := eq.GenerateMatchProof(v.Preimages, misses)
+		if err != nil {
+			return fmt.Errorf("vector %q: GenerateMatchProof: %w", v.Name, err)
+		}
+		if !bytes.Equal(seed, v.ExpectedSeed) {
+			return fmt.Errorf("vector %q: seed mismatch: expected %x, got %x", v.Name, v.ExpectedSeed, seed)
+		}
+		if !bytes.Equal(csum, v.ExpectedChecksum) {
+			return fmt.Errorf("vector %q: commitment checksum mismatch: expected %x, got %x", v.Name, v.ExpectedChecksum, csum)
+		}
+	}
+	return nil
+}
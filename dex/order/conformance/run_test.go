@@ -0,0 +1,64 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package conformance
+
+import (
+	"testing"
+
+	clientorder "decred.org/dcrdex/client/order"
+	"decred.org/dcrdex/dex/msgjson"
+	"decred.org/dcrdex/dex/order"
+	"github.com/decred/dcrd/crypto/blake256"
+)
+
+// newClientEpochQueue adapts client/order.NewEpochQueue to
+// NewEpochQueueFunc. This is the reference implementation the checked-in
+// corpus is generated against, so using it here means this self-test
+// exercises the real Enqueue/GenerateMatchProof path, not a parallel
+// reimplementation that could only ever agree with itself.
+func newClientEpochQueue() EpochQueue { return clientorder.NewEpochQueue() }
+
+func TestRunAgainstReferenceQueue(t *testing.T) {
+	var oid1, oid2 order.OrderID
+	oid1[0], oid2[0] = 1, 2
+	var pimg1, pimg2 order.Preimage
+	pimg1[0], pimg2[0] = 0xaa, 0xbb
+	commit1 := order.Commitment(blake256.Sum256(pimg1[:]))
+	commit2 := order.Commitment(blake256.Sum256(pimg2[:]))
+
+	q := clientorder.NewEpochQueue()
+	q.Enqueue(&msgjson.EpochOrderNote{OrderID: oid1[:], Commitment: commit1[:]})
+	q.Enqueue(&msgjson.EpochOrderNote{OrderID: oid2[:], Commitment: commit2[:]})
+	seed, csum, err := q.GenerateMatchProof([]order.Preimage{pimg1, pimg2}, nil)
+	if err != nil {
+		t.Fatalf("GenerateMatchProof: %v", err)
+	}
+
+	corpus := Corpus{{
+		Name:             "two-orders",
+		OrderIDs:         []order.OrderID{oid1, oid2},
+		Commitments:      []order.Commitment{commit1, commit2},
+		Preimages:        []order.Preimage{pimg1, pimg2},
+		EnqueueOrder:     []int{0, 1},
+		ExpectedSeed:     seed,
+		ExpectedChecksum: csum,
+	}}
+
+	Run(t, corpus, newClientEpochQueue)
+}
+
+// TestConformanceCorpus runs the checked-in testdata corpus generated by
+// cmd/genvectors against the reference implementation, so the edge cases
+// that corpus covers (empty queue, all-miss epoch, duplicate commitments,
+// large epoch) are exercised by every test run, not just sitting on disk.
+func TestConformanceCorpus(t *testing.T) {
+	corpus, err := LoadCorpus("testdata")
+	if err != nil {
+		t.Fatalf("LoadCorpus: %v", err)
+	}
+	if len(corpus) == 0 {
+		t.Fatal("testdata corpus is empty")
+	}
+	Run(t, corpus, newClientEpochQueue)
+}
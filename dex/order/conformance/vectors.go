@@ -0,0 +1,111 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+// Package conformance defines a checked-in corpus of EpochQueue match-proof
+// test vectors and a driver that can run the corpus against any
+// implementation of the EpochQueue shuffle-seed and commitment-checksum
+// construction. The goal is to let alternate client implementations (e.g.
+// Bison Wallet, or a third-party DEX client) verify that they produce
+// byte-for-byte identical match proofs to the reference implementation in
+// client/order.
+package conformance
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"decred.org/dcrdex/dex/order"
+)
+
+// Vector is a single conformance test vector. OrderIDs and Commitments are
+// parallel slices describing the full epoch queue prior to EnqueueOrder
+// being applied; Preimages holds the preimages of only the orders not
+// listed in Misses, in index order. EnqueueOrder gives the order in which the corresponding
+// order IDs should be fed to the implementation under test, simulating the
+// non-deterministic arrival order seen on the wire. Misses lists the order
+// IDs, by index into Commitments, that never broadcast a preimage and
+// should be excluded via GenerateMatchProof's misses argument.
+type Vector struct {
+	// Name is a short, human-readable description of what the vector
+	// exercises, e.g. "duplicate-commitments" or "all-miss-epoch".
+	Name string `json:"name"`
+
+	OrderIDs    []order.OrderID    `json:"order_ids"`
+	Commitments []order.Commitment `json:"commitments"`
+	Preimages   []order.Preimage   `json:"preimages"`
+
+	// EnqueueOrder is a permutation of indices into OrderIDs/Commitments
+	// giving the sequence in which Enqueue should be called.
+	EnqueueOrder []int `json:"enqueue_order"`
+
+	// Misses are indices into OrderIDs of orders with no broadcast
+	// preimage.
+	Misses []int `json:"misses"`
+
+	ExpectedSeed     HexBytes `json:"expected_seed"`
+	ExpectedChecksum HexBytes `json:"expected_csum"`
+}
+
+// HexBytes is a byte slice that (un)marshals to/from a hex string, used so
+// vector files are readable and diffable rather than arrays of integers.
+type HexBytes []byte
+
+// MarshalJSON satisfies json.Marshaler.
+func (b HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (b *HexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// Corpus is an ordered collection of vectors, as loaded from testdata.
+type Corpus []*Vector
+
+// LoadCorpus reads every *.json vector file in dir and returns them sorted
+// by file name so that corpus iteration order is stable and diff-friendly.
+func LoadCorpus(dir string) (Corpus, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("globbing %s: %w", dir, err)
+	}
+	sort.Strings(matches)
+
+	corpus := make(Corpus, 0, len(matches))
+	for _, fp := range matches {
+		b, err := os.ReadFile(fp)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", fp, err)
+		}
+		v := new(Vector)
+		if err := json.Unmarshal(b, v); err != nil {
+			return nil, fmt.Errorf("unmarshaling %s: %w", fp, err)
+		}
+		corpus = append(corpus, v)
+	}
+	return corpus, nil
+}
+
+// WriteVector writes v to dir/<name>.json, overwriting any existing file.
+// It is used by the vector generator command.
+func WriteVector(dir string, v *Vector) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, v.Name+".json"), b, 0644)
+}
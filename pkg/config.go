@@ -0,0 +1,122 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// target is one GOOS/GOARCH pair to build and archive.
+type target struct{ os, arch string }
+
+// releaseConfig holds everything that used to be package-level consts,
+// loaded from release.toml so operators can cut a release for a different
+// target list or version without editing this tool's source.
+type releaseConfig struct {
+	Relver  string
+	LDFlags string
+	Tags    string
+	Targets []target
+}
+
+// defaultConfig reproduces the historical built-in values, used when no
+// release.toml is present so `go run .` still works out of the box.
+func defaultConfig() *releaseConfig {
+	return &releaseConfig{
+		Relver: relver,
+		LDFlags: `-buildid= ` +
+			`-X decred.org/dcrdex/client/cmd/dexc.appPreRelease=beta ` +
+			`-X decred.org/dcrdex/client/cmd/dexc.appBuild= ` +
+			`-X decred.org/dcrdex/server/cmd/dcrdex.appPreRelease=beta ` +
+			`-X decred.org/dcrdex/server/cmd/dcrdex.appBuild= `,
+		Tags: tags,
+		Targets: []target{
+			{"darwin", "amd64"},
+			{"freebsd", "amd64"},
+			{"linux", "386"},
+			{"linux", "amd64"},
+			{"linux", "arm"},
+			{"linux", "arm64"},
+			{"openbsd", "amd64"},
+			{"windows", "386"},
+			{"windows", "amd64"},
+		},
+	}
+}
+
+// loadConfig reads a release.toml from path. The format is a small,
+// intentionally minimal TOML subset: top-level `key = "value"` strings
+// and repeated `[[targets]]` tables with `os`/`arch` string keys. If path
+// does not exist, defaultConfig is returned unmodified.
+func loadConfig(path string) (*releaseConfig, error) {
+	cfg := defaultConfig()
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	cfg.Targets = nil // release.toml fully replaces the default target list
+	var inTarget bool
+	var cur target
+
+	flushTarget := func() {
+		if inTarget && cur.os != "" && cur.arch != "" {
+			cfg.Targets = append(cfg.Targets, cur)
+		}
+		cur = target{}
+	}
+
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "[[targets]]" {
+			flushTarget()
+			inTarget = true
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, lineNo)
+		}
+		k = strings.TrimSpace(k)
+		v = strings.TrimSpace(v)
+		v = strings.Trim(v, `"`)
+
+		switch {
+		case inTarget && k == "os":
+			cur.os = v
+		case inTarget && k == "arch":
+			cur.arch = v
+		case !inTarget && k == "relver":
+			cfg.Relver = v
+		case !inTarget && k == "ldflags":
+			cfg.LDFlags = v
+		case !inTarget && k == "tags":
+			cfg.Tags = v
+		default:
+			return nil, fmt.Errorf("%s:%d: unrecognized key %q", path, lineNo, k)
+		}
+	}
+	flushTarget()
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(cfg.Targets) == 0 {
+		cfg.Targets = defaultConfig().Targets
+	}
+	return cfg, nil
+}
@@ -23,31 +23,19 @@ func findGo() string {
 }
 
 var (
-	gobin     = flag.String("go", findGo(), "Go binary")
-	nobuild   = flag.Bool("nobuild", false, "skip go build")
-	noarchive = flag.Bool("noarchive", false, "skip archiving")
+	gobin              = flag.String("go", findGo(), "Go binary")
+	nobuild            = flag.Bool("nobuild", false, "skip go build")
+	noarchive          = flag.Bool("noarchive", false, "skip archiving")
+	releaseConfigPath  = flag.String("config", "release.toml", "path to release.toml; missing file falls back to built-in defaults")
+	signWith           = flag.String("sign", "", `sign the manifest: "gpg", "minisign", or "" to skip`)
+	signKey            = flag.String("key", "", "signing key: a GPG key ID, or a minisign secret key file")
+	sourceMode         = flag.Bool("source", false, "produce a deterministic source tarball with vendored deps and exit")
+	verifyDir          = flag.String("verify", "", "verify an unpacked archive directory against -verify-manifest and exit")
+	verifyManifestPath = flag.String("verify-manifest", "", "manifest file to verify -verify against")
 )
 
-var targets = []struct{ os, arch string }{
-	{"darwin", "amd64"},
-	{"freebsd", "amd64"},
-	{"linux", "386"},
-	{"linux", "amd64"},
-	{"linux", "arm"},
-	{"linux", "arm64"},
-	{"openbsd", "amd64"},
-	{"windows", "386"},
-	{"windows", "amd64"},
-}
-
 const relver = "v0.0.1"
 
-const ldflags = `-buildid= ` +
-	`-X decred.org/dcrdex/client/cmd/dexc.appPreRelease=beta ` +
-	`-X decred.org/dcrdex/client/cmd/dexc.appBuild= ` +
-	`-X decred.org/dcrdex/server/cmd/dcrdex.appPreRelease=beta ` +
-	`-X decred.org/dcrdex/server/cmd/dcrdex.appBuild= `
-
 const tags = ""
 
 var tools = []struct{ builddir, outdir string }{
@@ -65,22 +53,59 @@ type manifest []manifestLine
 
 func main() {
 	flag.Parse()
+
+	if *verifyDir != "" {
+		if *verifyManifestPath == "" {
+			log.Fatal("-verify-manifest is required with -verify")
+		}
+		if err := runVerify(*verifyDir, *verifyManifestPath); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(*releaseConfigPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *sourceMode {
+		// The tool runs from pkg/ (see tools[].builddir above), so the
+		// repository root buildSourceTarball is documented to archive is
+		// one level up, not the tool's own working directory.
+		if err := buildSourceTarball(cfg, ".."); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	logvers()
 	var m manifest
-	for i := range targets {
+	var atts []archiveAttestation
+	for _, t := range cfg.Targets {
 		for j := range tools {
 			if *nobuild {
 				break
 			}
-			build(targets[i].os, targets[i].arch, tools[j].builddir, tools[j].outdir)
+			build(cfg, t.os, t.arch, tools[j].builddir, tools[j].outdir)
 		}
 		if *noarchive {
 			continue
 		}
-		archive(targets[i].os, targets[i].arch, &m)
+		archiveName := archive(cfg, t.os, t.arch, &m)
+		att, err := attestArchive(cfg, t.os, t.arch, archiveName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		atts = append(atts, att)
 	}
 	if len(m) > 0 {
-		writeManifest(m)
+		writeManifest(cfg, m)
+	}
+	if len(atts) > 0 {
+		if err := writeAttestationManifest(cfg, atts); err != nil {
+			log.Fatal(err)
+		}
 	}
 }
 
@@ -122,13 +147,13 @@ func exeName(module, goos string) string {
 // 	return output
 // }
 
-func build(goos, arch, builddir, out string) {
+func build(cfg *releaseConfig, goos, arch, builddir, out string) {
 	out, err := filepath.Abs(filepath.Join(out, goos+"-"+arch, exeName(builddir, goos)))
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Println(out)
-	gocmd(goos, arch, builddir, "build", "-trimpath", "-tags", tags, "-o", out, "-ldflags", ldflags)
+	gocmd(goos, arch, builddir, "build", "-trimpath", "-tags", cfg.Tags, "-o", out, "-ldflags", cfg.LDFlags)
 }
 
 func gocmd(goos, arch, builddir string, args ...string) {
@@ -152,7 +177,7 @@ func gocmd(goos, arch, builddir string, args ...string) {
 	}
 }
 
-func archive(goos, arch string, m *manifest) {
+func archive(cfg *releaseConfig, goos, arch string, m *manifest) (archiveName string) {
 	if _, err := os.Stat("archive"); os.IsNotExist(err) {
 		err := os.Mkdir("archive", 0777)
 		if err != nil {
@@ -160,10 +185,9 @@ func archive(goos, arch string, m *manifest) {
 		}
 	}
 	if goos == "windows" {
-		archiveZip(goos, arch, m)
-		return
+		return archiveZip(cfg, goos, arch, m)
 	}
-	tarPath := fmt.Sprintf("decred-%s-%s-%s", goos, arch, relver)
+	tarPath := fmt.Sprintf("decred-%s-%s-%s", goos, arch, cfg.Relver)
 	tarFile, err := os.Create(fmt.Sprintf("archive/%s.tar", tarPath))
 	if err != nil {
 		log.Fatal(err)
@@ -224,10 +248,10 @@ func archive(goos, arch string, m *manifest) {
 	}
 	hash := sha256.New()
 	defer func() {
-		name := filepath.Base(tarFile.Name()) + ".gz"
+		archiveName = filepath.Base(tarFile.Name()) + ".gz"
 		var sum [32]byte
 		copy(sum[:], hash.Sum(nil))
-		*m = append(*m, manifestLine{name, sum})
+		*m = append(*m, manifestLine{archiveName, sum})
 	}()
 	w := io.MultiWriter(zf, hash)
 	zw := gzip.NewWriter(w)
@@ -251,10 +275,11 @@ func archive(goos, arch string, m *manifest) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	return archiveName
 }
 
-func archiveZip(goos, arch string, m *manifest) {
-	zipPath := fmt.Sprintf("decred-%s-%s-%s", goos, arch, relver)
+func archiveZip(cfg *releaseConfig, goos, arch string, m *manifest) (archiveName string) {
+	zipPath := fmt.Sprintf("decred-%s-%s-%s", goos, arch, cfg.Relver)
 	zipFile, err := os.Create(fmt.Sprintf("archive/%s.zip", zipPath))
 	defer zipFile.Close()
 	if err != nil {
@@ -263,10 +288,10 @@ func archiveZip(goos, arch string, m *manifest) {
 	hash := sha256.New()
 	w := io.MultiWriter(zipFile, hash)
 	defer func() {
-		name := filepath.Base(zipFile.Name())
+		archiveName = filepath.Base(zipFile.Name())
 		var sum [32]byte
 		copy(sum[:], hash.Sum(nil))
-		*m = append(*m, manifestLine{name, sum})
+		*m = append(*m, manifestLine{archiveName, sum})
 	}()
 	log.Printf("archive: %v", zipFile.Name())
 	zw := zip.NewWriter(w)
@@ -301,10 +326,11 @@ func archiveZip(goos, arch string, m *manifest) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	return archiveName
 }
 
-func writeManifest(m manifest) {
-	fi, err := os.Create(fmt.Sprintf("archive/decred-%s-manifest.txt", relver))
+func writeManifest(cfg *releaseConfig, m manifest) {
+	fi, err := os.Create(fmt.Sprintf("archive/decred-%s-manifest.txt", cfg.Relver))
 	if err != nil {
 		log.Fatal(err)
 	}
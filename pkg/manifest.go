@@ -0,0 +1,155 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// fileAttestation is the SHA256 of a single file embedded in an archive,
+// e.g. a built executable.
+type fileAttestation struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// archiveAttestation is an in-toto-style statement about how one release
+// archive was produced: enough for a third party to rebuild it from the
+// same commit and confirm a byte-identical result.
+type archiveAttestation struct {
+	Archive   string            `json:"archive"`
+	GOOS      string            `json:"goos"`
+	GOARCH    string            `json:"goarch"`
+	GoVersion string            `json:"go_version"`
+	LDFlags   string            `json:"ldflags"`
+	Tags      string            `json:"tags"`
+	GitCommit string            `json:"git_commit"`
+	Files     []fileAttestation `json:"files"`
+}
+
+// attestationManifest is the full set of archive attestations for a
+// release, written to decred-<relver>-attestation.json.
+type attestationManifest struct {
+	Relver   string               `json:"relver"`
+	Archives []archiveAttestation `json:"archives"`
+}
+
+// hashFile returns the lowercase hex SHA256 digest of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// goVersion shells out to `go version` and returns the trimmed output,
+// reusing *gobin so the attestation matches what actually built the
+// binaries.
+func goVersion() string {
+	out, err := exec.Command(*gobin, "version").Output()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitCommit returns the current HEAD commit hash, or "unknown" if this
+// isn't a git checkout (e.g. a tarball release of the tool itself).
+func gitCommit() string {
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// attestArchive builds the archiveAttestation for one target's archive by
+// hashing every tool binary that was embedded in it.
+func attestArchive(cfg *releaseConfig, goos, arch, archiveName string) (archiveAttestation, error) {
+	att := archiveAttestation{
+		Archive:   archiveName,
+		GOOS:      goos,
+		GOARCH:    arch,
+		GoVersion: goVersion(),
+		LDFlags:   cfg.LDFlags,
+		Tags:      cfg.Tags,
+		GitCommit: gitCommit(),
+	}
+	for i := range tools {
+		exe := exeName(tools[i].builddir, goos)
+		exePath := filepath.Join("bin", goos+"-"+arch, exe)
+		sum, err := hashFile(exePath)
+		if err != nil {
+			return att, fmt.Errorf("hashing %s: %w", exePath, err)
+		}
+		att.Files = append(att.Files, fileAttestation{Name: exe, SHA256: sum})
+	}
+	return att, nil
+}
+
+// writeAttestationManifest writes the attestation JSON to
+// archive/decred-<relver>-attestation.json and, if *signWith is set,
+// produces a detached signature alongside it.
+func writeAttestationManifest(cfg *releaseConfig, atts []archiveAttestation) error {
+	am := attestationManifest{Relver: cfg.Relver, Archives: atts}
+	b, err := json.MarshalIndent(am, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("archive/decred-%s-attestation.json", cfg.Relver)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return err
+	}
+	log.Printf("attestation: %v", path)
+
+	if *signWith == "" {
+		return nil
+	}
+	return signFile(path)
+}
+
+// signFile produces a detached signature for path using the -sign/-key
+// flags, invoking the external gpg or minisign binary the same way the
+// rest of this tool shells out to `go`.
+func signFile(path string) error {
+	switch *signWith {
+	case "gpg":
+		args := []string{"--batch", "--yes", "--detach-sign", "--armor"}
+		if *signKey != "" {
+			args = append(args, "--local-user", *signKey)
+		}
+		args = append(args, path)
+		out, err := exec.Command("gpg", args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("gpg sign %s: %w: %s", path, err, out)
+		}
+		log.Printf("signed %s.asc", path)
+	case "minisign":
+		if *signKey == "" {
+			return fmt.Errorf("-key is required for minisign signing")
+		}
+		out, err := exec.Command("minisign", "-S", "-s", *signKey, "-m", path).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("minisign sign %s: %w: %s", path, err, out)
+		}
+		log.Printf("signed %s.minisig", path)
+	default:
+		return fmt.Errorf("unrecognized -sign value %q", *signWith)
+	}
+	return nil
+}
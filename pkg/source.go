@@ -0,0 +1,160 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// sourceEpoch is used for every tar header timestamp in the source
+// tarball so that two builds of the same commit produce byte-identical
+// output regardless of checkout mtimes.
+var sourceEpoch = time.Unix(0, 0).UTC()
+
+// buildSourceTarball vendors the module's dependencies with `go mod
+// vendor` and writes archive/decred-<relver>-src.tar.gz containing the
+// repository root (excluding .git and this tool's archive output
+// directory) plus the vendor directory, with
+// deterministic tar headers so the result is reproducible from a given
+// commit.
+func buildSourceTarball(cfg *releaseConfig, repoRoot string) error {
+	vendorCmd := exec.Command(*gobin, "mod", "vendor")
+	vendorCmd.Dir = repoRoot
+	if out, err := vendorCmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("go mod vendor: %w: %s", err, out)
+	}
+
+	if _, err := os.Stat("archive"); os.IsNotExist(err) {
+		if err := os.Mkdir("archive", 0777); err != nil {
+			return err
+		}
+	}
+
+	// The archive directory may lie inside repoRoot; it is skipped below so
+	// the tarball never contains itself or other release output.
+	archiveDir, err := filepath.Abs("archive")
+	if err != nil {
+		return err
+	}
+
+	tarPath := fmt.Sprintf("archive/decred-%s-src.tar.gz", cfg.Relver)
+	f, err := os.Create(tarPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+
+	var paths []string
+	err = filepath.WalkDir(repoRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(repoRoot, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			if abs, err := filepath.Abs(p); err == nil && abs == archiveDir {
+				return filepath.SkipDir
+			}
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walking %s: %w", repoRoot, err)
+	}
+	sort.Strings(paths) // deterministic entry order independent of FS traversal order
+
+	for _, rel := range paths {
+		full := filepath.Join(repoRoot, rel)
+		info, err := os.Lstat(full)
+		if err != nil {
+			return err
+		}
+		if err := addSourceEntry(tw, full, rel, info); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("source archive: %s", tarPath)
+	return nil
+}
+
+func addSourceEntry(tw *tar.Writer, full, rel string, info fs.FileInfo) error {
+	if info.IsDir() {
+		hdr := &tar.Header{
+			Name:     rel + "/",
+			Typeflag: tar.TypeDir,
+			Mode:     0755,
+			ModTime:  sourceEpoch,
+			Format:   tar.FormatPAX,
+		}
+		return tw.WriteHeader(hdr)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(full)
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{
+			Name:     rel,
+			Typeflag: tar.TypeSymlink,
+			Linkname: target,
+			Mode:     0644,
+			ModTime:  sourceEpoch,
+			Format:   tar.FormatPAX,
+		}
+		return tw.WriteHeader(hdr)
+	}
+
+	mode := int64(0644)
+	if info.Mode()&0111 != 0 {
+		mode = 0755
+	}
+	hdr := &tar.Header{
+		Name:     rel,
+		Typeflag: tar.TypeReg,
+		Mode:     mode,
+		Size:     info.Size(),
+		ModTime:  sourceEpoch,
+		Format:   tar.FormatPAX,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	r, err := os.Open(full)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(tw, r)
+	return err
+}
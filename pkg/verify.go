@@ -0,0 +1,90 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runVerify checks that every file hash recorded in the attestation for
+// dir's GOOS/GOARCH matches what's actually present in dir, i.e. that dir
+// is a bit-identical unpacking of the archive the attestation describes.
+// It is invoked via -verify=<dir> -verify-manifest=<attestation.json>.
+func runVerify(dir, manifestPath string) error {
+	b, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", manifestPath, err)
+	}
+	var am attestationManifest
+	if err := json.Unmarshal(b, &am); err != nil {
+		return fmt.Errorf("parsing %s: %w", manifestPath, err)
+	}
+
+	goos, arch, err := hostTargetFromDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var att *archiveAttestation
+	for i := range am.Archives {
+		if am.Archives[i].GOOS == goos && am.Archives[i].GOARCH == arch {
+			att = &am.Archives[i]
+			break
+		}
+	}
+	if att == nil {
+		return fmt.Errorf("no attestation for %s/%s in %s", goos, arch, manifestPath)
+	}
+
+	var mismatches []string
+	for _, f := range att.Files {
+		path := filepath.Join(dir, f.Name)
+		sum, err := hashFile(path)
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %v", f.Name, err))
+			continue
+		}
+		if sum != f.SHA256 {
+			mismatches = append(mismatches, fmt.Sprintf("%s: expected sha256 %s, got %s", f.Name, f.SHA256, sum))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("verification failed for %s:\n  %s", dir, joinLines(mismatches))
+	}
+	fmt.Printf("OK: %s matches attested build for %s/%s (commit %s)\n", dir, goos, arch, att.GitCommit)
+	return nil
+}
+
+// hostTargetFromDir expects dir to be named like
+// "decred-<goos>-<arch>-<relver>" (the layout archive/archiveZip in
+// main.go produce, and thus what an unpacked release archive is named),
+// and splits out goos and arch. relver is ignored here and may itself
+// contain dashes (e.g. a "-rc1" suffix).
+func hostTargetFromDir(dir string) (goos, arch string, err error) {
+	base := filepath.Base(filepath.Clean(dir))
+	const prefix = "decred-"
+	if !strings.HasPrefix(base, prefix) {
+		return "", "", fmt.Errorf("cannot determine GOOS-GOARCH from directory name %q; expected e.g. decred-linux-amd64-%s", base, relver)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(base, prefix), "-", 3)
+	if len(parts) < 3 {
+		return "", "", fmt.Errorf("cannot determine GOOS-GOARCH from directory name %q; expected e.g. decred-linux-amd64-%s", base, relver)
+	}
+	return parts[0], parts[1], nil
+}
+
+func joinLines(lines []string) string {
+	out := ""
+	for i, l := range lines {
+		if i > 0 {
+			out += "\n  "
+		}
+		out += l
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package auth
+
+// dcrAssetID is the BIP-44 coin type for Decred, and the implicit
+// registration fee asset for clients that don't set msgjson.Register.AssetID.
+const dcrAssetID = 42
+
+// FeeAsset is implemented by an asset backend that is eligible to accept
+// client registration fees. It lets AuthManager validate and quote fees in
+// any registered asset rather than hard-coding DCR.
+type FeeAsset interface {
+	// CheckFee looks up the fee coin by ID and reports the address it
+	// pays, its value, and its current confirmation count. An error is
+	// returned only for a malformed or unknown coinID; a low confirmation
+	// count is reported via confs, not an error.
+	CheckFee(coinID []byte) (addr string, val, confs uint64, err error)
+
+	// RegFee is the registration fee required by this asset, in the
+	// asset's atomic units.
+	RegFee() uint64
+}
+
+// RegisterFeeAsset adds or replaces the FeeAsset backend for assetID,
+// making it eligible as a registration fee asset for handleRegister and
+// handleNotifyFee.
+func (auth *AuthManager) RegisterFeeAsset(assetID uint32, fa FeeAsset) {
+	auth.feeAssetsMtx.Lock()
+	defer auth.feeAssetsMtx.Unlock()
+	if auth.feeAssets == nil {
+		auth.feeAssets = make(map[uint32]FeeAsset)
+	}
+	auth.feeAssets[assetID] = fa
+}
+
+// feeAsset retrieves the FeeAsset backend registered for assetID, if any.
+func (auth *AuthManager) feeAsset(assetID uint32) (FeeAsset, bool) {
+	auth.feeAssetsMtx.Lock()
+	defer auth.feeAssetsMtx.Unlock()
+	fa, ok := auth.feeAssets[assetID]
+	return fa, ok
+}
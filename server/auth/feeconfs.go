@@ -0,0 +1,47 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package auth
+
+import (
+	"time"
+
+	"decred.org/dcrdex/dex/asset"
+)
+
+// targetFeeConfTime is the wall-clock assurance a registration fee
+// confirmation count should provide, independent of how fast any one
+// chain happens to be producing blocks.
+var targetFeeConfTime = 10 * time.Minute
+
+// RegisterBlockTimeMonitor attaches a BlockTimeMonitor for assetID,
+// letting feeConfsFor compute a dynamic confirmation requirement for that
+// asset's registration fee instead of using the static auth.feeConfs.
+func (auth *AuthManager) RegisterBlockTimeMonitor(assetID uint32, m *asset.BlockTimeMonitor) {
+	auth.blockTimeMonitorsMtx.Lock()
+	defer auth.blockTimeMonitorsMtx.Unlock()
+	if auth.blockTimeMonitors == nil {
+		auth.blockTimeMonitors = make(map[uint32]*asset.BlockTimeMonitor)
+	}
+	auth.blockTimeMonitors[assetID] = m
+}
+
+// feeConfsFor returns the confirmation requirement to use when validating
+// a registration fee paid in assetID: the asset's BlockTimeMonitor
+// recommendation if one is registered, else the static auth.feeConfs.
+func (auth *AuthManager) feeConfsFor(assetID uint32) uint64 {
+	auth.blockTimeMonitorsMtx.RLock()
+	m, found := auth.blockTimeMonitors[assetID]
+	auth.blockTimeMonitorsMtx.RUnlock()
+	if !found {
+		return auth.feeConfs
+	}
+	return uint64(m.RequiredConfs(targetFeeConfTime))
+}
+
+// FeeConfs reports the currently required registration fee confirmation
+// count for assetID. It is exported for the admin RPC to surface the
+// live, dynamically-adjusted value to an operator.
+func (auth *AuthManager) FeeConfs(assetID uint32) uint64 {
+	return auth.feeConfsFor(assetID)
+}
@@ -59,8 +59,26 @@ func (auth *AuthManager) handleRegister(conn comms.Link, msg *msgjson.Message) *
 		}
 	}
 
-	// Register account and get a fee payment address.
-	feeAddr, err := auth.storage.CreateAccount(acct)
+	// Resolve the requested fee asset. AssetID defaults to the zero value
+	// (DCR) for clients that predate multi-asset registration.
+	assetID := register.AssetID
+	regFee := auth.regFee
+	var feeAsset FeeAsset
+	if assetID != dcrAssetID {
+		var found bool
+		feeAsset, found = auth.feeAsset(assetID)
+		if !found {
+			return &msgjson.Error{
+				Code:    msgjson.RegisterAssetError,
+				Message: "unsupported registration asset",
+			}
+		}
+		regFee = feeAsset.RegFee()
+	}
+
+	// Register account and get a fee payment address for the requested
+	// asset.
+	feeAddr, err := auth.storage.CreateAccountWithAsset(acct, assetID)
 	if err != nil {
 		return &msgjson.Error{
 			Code:    msgjson.RPCInternalError,
@@ -73,7 +91,8 @@ func (auth *AuthManager) handleRegister(conn comms.Link, msg *msgjson.Message) *
 		DEXPubKey:    auth.signer.PubKey().SerializeCompressed(),
 		ClientPubKey: register.PubKey,
 		Address:      feeAddr,
-		Fee:          auth.regFee,
+		Fee:          regFee,
+		AssetID:      assetID,
 		Time:         encode.UnixMilliU((unixMsNow())),
 	}
 
@@ -167,9 +186,10 @@ func (auth *AuthManager) handleNotifyFee(conn comms.Link, msg *msgjson.Message)
 		}
 	}
 
-	// Get the registration fee address assigned to the client's account.
-	regAddr, err := auth.storage.AccountRegAddr(acctID)
-	log.Debugf("Account %x registration fee address: %v", acctID, regAddr)
+	// Get the registration fee address and chosen asset assigned to the
+	// client's account.
+	regAddr, regAssetID, err := auth.storage.AccountRegAddr(acctID)
+	log.Debugf("Account %x registration fee address: %v (asset %d)", acctID, regAddr, regAssetID)
 	if err != nil {
 		return &msgjson.Error{
 			Code:    msgjson.RPCInternalError,
@@ -177,11 +197,27 @@ func (auth *AuthManager) handleNotifyFee(conn comms.Link, msg *msgjson.Message)
 		}
 	}
 
+	// checkFee and regFee default to the DCR backend, overridden below if
+	// the account registered with an alternate asset.
+	checkFee, regFee := auth.checkFee, auth.regFee
+	if regAssetID != dcrAssetID {
+		feeAsset, found := auth.feeAsset(regAssetID)
+		if !found {
+			return &msgjson.Error{
+				Code:    msgjson.RegisterAssetError,
+				Message: "registration asset no longer supported",
+			}
+		}
+		checkFee, regFee = feeAsset.CheckFee, feeAsset.RegFee()
+	}
+
 	auth.coinWaiter.Wait(coinwaiter.NewSettings(acctID, msg, notifyFee.CoinID, txWaitExpiration), func() bool {
-		// Validate fee.
+		// Validate fee. feeConfs is recomputed on every retry since the
+		// asset's BlockTimeMonitor recommendation can change while a coin
+		// waiter is pending.
 		log.Debugf("checking fee from coin %x", notifyFee.CoinID)
-		addr, val, confs, err := auth.checkFee(notifyFee.CoinID)
-		if err != nil || confs < auth.feeConfs {
+		addr, val, confs, err := checkFee(notifyFee.CoinID)
+		if err != nil || confs < auth.feeConfsFor(regAssetID) {
 			log.Debugf("Failed to check fee: confs=%d, err=%v", confs, err)
 			return coinwaiter.TryAgain
 		}
@@ -200,7 +236,7 @@ func (auth *AuthManager) handleNotifyFee(conn comms.Link, msg *msgjson.Message)
 				}
 			}
 		}()
-		if val < auth.regFee {
+		if val < regFee {
 			msgErr = &msgjson.Error{
 				Code:    msgjson.FeeError,
 				Message: "fee too low",
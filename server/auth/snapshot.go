@@ -0,0 +1,217 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package auth
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"decred.org/dcrdex/server/account"
+	"decred.org/dcrdex/server/coinwaiter"
+)
+
+// waiterSnapshotVersion is the encoding version for AuthManager.Snapshot
+// output, bumped when the epoch-queue section was added.
+const waiterSnapshotVersion = 1
+
+// pendingWaiter is the subset of a coinwaiter.Settings that is both
+// serializable and sufficient to replay a 'notifyfee' coin check after a
+// restart. The original request message and completion callback are not
+// persisted; Restore reconstructs the callback from auth.checkFee (or the
+// account's registered FeeAsset) the same way handleNotifyFee does.
+type pendingWaiter struct {
+	acctID account.AccountID
+	coinID []byte
+	expiry time.Time
+}
+
+// epochQueueSnapshotter is implemented by a live order.EpochQueue. It is
+// defined here rather than imported so AuthManager, a server package, does
+// not depend on the client/order package; a market registers its epoch
+// queue through RegisterEpochQueue to satisfy this interface.
+type epochQueueSnapshotter interface {
+	Snapshot() ([]byte, error)
+	Restore([]byte) error
+}
+
+// RegisterEpochQueue registers the live epoch queue for market mktName so
+// its enqueued order notes are included in future Snapshot calls. A market
+// should call this once, when it starts.
+//
+// If Restore previously decoded a snapshot for mktName before the market
+// had registered its queue (the normal startup order: Restore runs before
+// markets start), the queue's enqueued notes are restored immediately and
+// the pending blob is discarded.
+func (auth *AuthManager) RegisterEpochQueue(mktName string, eq epochQueueSnapshotter) {
+	auth.epochQueuesMtx.Lock()
+	defer auth.epochQueuesMtx.Unlock()
+	if auth.epochQueues == nil {
+		auth.epochQueues = make(map[string]epochQueueSnapshotter)
+	}
+	auth.epochQueues[mktName] = eq
+	if blob, ok := auth.pendingEpochSnapshots[mktName]; ok {
+		if err := eq.Restore(blob); err != nil {
+			log.Errorf("RegisterEpochQueue: restoring epoch queue for market %q: %v", mktName, err)
+		}
+		delete(auth.pendingEpochSnapshots, mktName)
+	}
+}
+
+// Snapshot serializes every pending 'notifyfee' coin waiter, followed by
+// the enqueued order notes of every registered epoch queue (see
+// RegisterEpochQueue), so both can be persisted and replayed after a
+// restart. This avoids the loss of unpaid-but-observed registration fee
+// transactions as well as in-progress epoch commitments. Call it
+// periodically from a checkpoint loop.
+func (auth *AuthManager) Snapshot() ([]byte, error) {
+	waiters := auth.coinWaiter.Pending()
+
+	buf := []byte{waiterSnapshotVersion}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(waiters)))
+	for _, w := range waiters {
+		buf = append(buf, w.AccountID[:]...)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(w.CoinID)))
+		buf = append(buf, w.CoinID...)
+		expiryMs := w.Expiration.UnixNano() / int64(time.Millisecond)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(expiryMs))
+	}
+
+	auth.epochQueuesMtx.Lock()
+	defer auth.epochQueuesMtx.Unlock()
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(auth.epochQueues)))
+	for mktName, eq := range auth.epochQueues {
+		blob, err := eq.Snapshot()
+		if err != nil {
+			return nil, fmt.Errorf("snapshotting epoch queue for market %q: %w", mktName, err)
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(mktName)))
+		buf = append(buf, mktName...)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(blob)))
+		buf = append(buf, blob...)
+	}
+	return buf, nil
+}
+
+// Restore decodes a Snapshot, re-enqueuing each pending coin waiter through
+// auth.checkFee (or the account's chosen FeeAsset) exactly as
+// handleNotifyFee would have, and re-enqueuing each market's epoch notes
+// before it starts soliciting preimages. A market that has not yet called
+// RegisterEpochQueue when Restore runs has its blob held in
+// pendingEpochSnapshots and applied when it does. It should be called once
+// at startup, before the server begins accepting new connections.
+func (auth *AuthManager) Restore(b []byte) error {
+	if len(b) < 1 {
+		return fmt.Errorf("snapshot too short")
+	}
+	if ver := b[0]; ver != waiterSnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", ver)
+	}
+	b = b[1:]
+
+	if len(b) < 4 {
+		return fmt.Errorf("snapshot missing waiter count")
+	}
+	n := binary.BigEndian.Uint32(b)
+	b = b[4:]
+
+	for i := uint32(0); i < n; i++ {
+		if len(b) < account.HashSize+4 {
+			return fmt.Errorf("truncated snapshot at waiter %d", i)
+		}
+		var acctID account.AccountID
+		copy(acctID[:], b[:account.HashSize])
+		b = b[account.HashSize:]
+
+		coinIDLen := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		if uint32(len(b)) < coinIDLen+8 {
+			return fmt.Errorf("truncated snapshot at waiter %d", i)
+		}
+		coinID := append([]byte(nil), b[:coinIDLen]...)
+		b = b[coinIDLen:]
+
+		expiryMs := binary.BigEndian.Uint64(b)
+		b = b[8:]
+		expiry := time.UnixMilli(int64(expiryMs))
+
+		auth.replayCoinWaiter(acctID, coinID, expiry)
+	}
+
+	if len(b) < 4 {
+		return fmt.Errorf("snapshot missing epoch queue count")
+	}
+	numQueues := binary.BigEndian.Uint32(b)
+	b = b[4:]
+
+	auth.epochQueuesMtx.Lock()
+	defer auth.epochQueuesMtx.Unlock()
+	for i := uint32(0); i < numQueues; i++ {
+		if len(b) < 4 {
+			return fmt.Errorf("truncated snapshot at epoch queue %d", i)
+		}
+		nameLen := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		if uint32(len(b)) < nameLen+4 {
+			return fmt.Errorf("truncated snapshot at epoch queue %d", i)
+		}
+		mktName := string(b[:nameLen])
+		b = b[nameLen:]
+
+		blobLen := binary.BigEndian.Uint32(b)
+		b = b[4:]
+		if uint32(len(b)) < blobLen {
+			return fmt.Errorf("truncated snapshot at epoch queue %d", i)
+		}
+		blob := append([]byte(nil), b[:blobLen]...)
+		b = b[blobLen:]
+
+		if eq, ok := auth.epochQueues[mktName]; ok {
+			if err := eq.Restore(blob); err != nil {
+				return fmt.Errorf("restoring epoch queue for market %q: %w", mktName, err)
+			}
+			continue
+		}
+		if auth.pendingEpochSnapshots == nil {
+			auth.pendingEpochSnapshots = make(map[string][]byte)
+		}
+		auth.pendingEpochSnapshots[mktName] = blob
+	}
+	return nil
+}
+
+// replayCoinWaiter re-enqueues a single coin waiter recovered from a
+// snapshot, reusing the same checkFee/regAddr/regFee resolution that
+// handleNotifyFee performs for a live request.
+func (auth *AuthManager) replayCoinWaiter(acctID account.AccountID, coinID []byte, expiry time.Time) {
+	regAddr, regAssetID, err := auth.storage.AccountRegAddr(acctID)
+	if err != nil {
+		log.Errorf("replayCoinWaiter: AccountRegAddr(%x): %v", acctID, err)
+		return
+	}
+
+	checkFee, regFee := auth.checkFee, auth.regFee
+	if regAssetID != dcrAssetID {
+		feeAsset, found := auth.feeAsset(regAssetID)
+		if !found {
+			log.Errorf("replayCoinWaiter: account %x registered with unsupported asset %d", acctID, regAssetID)
+			return
+		}
+		checkFee, regFee = feeAsset.CheckFee, feeAsset.RegFee()
+	}
+
+	auth.coinWaiter.Wait(coinwaiter.NewSettingsExpiringAt(acctID, nil, coinID, expiry), func() bool {
+		addr, val, confs, err := checkFee(coinID)
+		if err != nil || confs < auth.feeConfsFor(regAssetID) {
+			return coinwaiter.TryAgain
+		}
+		if val < regFee || addr != regAddr {
+			return coinwaiter.DontTryAgain
+		}
+		if err := auth.storage.PayAccount(acctID, coinID); err != nil {
+			log.Errorf("replayCoinWaiter: PayAccount(%x): %v", acctID, err)
+		}
+		return coinwaiter.DontTryAgain
+	})
+}
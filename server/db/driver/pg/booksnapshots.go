@@ -0,0 +1,100 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package pg
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// bookSnapshotsTableName is the per-market table that stores the sorted
+// buy/sell rate-quantity ladder at the close of every matched epoch. It is
+// the missing input that epoch_reports.book_buys*/book_sells* needs;
+// see v2Upgrade for the historical gap this closes going forward.
+const bookSnapshotsTableName = "book_snapshots"
+
+const createBookSnapshotsTableStmt = `CREATE TABLE IF NOT EXISTS %s (
+	epoch_idx INT8,
+	epoch_dur INT8,
+	buys BYTEA,
+	sells BYTEA,
+	PRIMARY KEY (epoch_idx, epoch_dur)
+);`
+
+const insertBookSnapshotStmt = `INSERT INTO %s (epoch_idx, epoch_dur, buys, sells)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (epoch_idx, epoch_dur) DO UPDATE SET buys = $3, sells = $4;`
+
+const selectBookSnapshotStmt = `SELECT buys, sells FROM %s WHERE epoch_idx = $1 AND epoch_dur = $2;`
+
+// BookPoint is a single rate-quantity point in a book snapshot ladder.
+type BookPoint struct {
+	Rate uint64
+	Qty  uint64
+}
+
+// encodeLadder packs a ladder as a sequence of 16-byte (rate,qty) big
+// endian entries, sorted order is the caller's responsibility (the
+// matcher already produces a sorted ladder for bookVolumes).
+func encodeLadder(ladder []BookPoint) []byte {
+	buf := make([]byte, 0, len(ladder)*16)
+	for _, p := range ladder {
+		buf = binary.BigEndian.AppendUint64(buf, p.Rate)
+		buf = binary.BigEndian.AppendUint64(buf, p.Qty)
+	}
+	return buf
+}
+
+// decodeLadder reverses encodeLadder.
+func decodeLadder(b []byte) ([]BookPoint, error) {
+	if len(b)%16 != 0 {
+		return nil, fmt.Errorf("ladder encoding has %d bytes, not a multiple of 16", len(b))
+	}
+	ladder := make([]BookPoint, len(b)/16)
+	for i := range ladder {
+		entry := b[i*16:]
+		ladder[i] = BookPoint{
+			Rate: binary.BigEndian.Uint64(entry[:8]),
+			Qty:  binary.BigEndian.Uint64(entry[8:16]),
+		}
+	}
+	return ladder, nil
+}
+
+// createBookSnapshotsTable creates the book_snapshots table for mktSchema
+// if it does not already exist.
+func createBookSnapshotsTable(db txOrDB, mktSchema string) error {
+	fullName := mktSchema + "." + bookSnapshotsTableName
+	_, err := db.Exec(fmt.Sprintf(createBookSnapshotsTableStmt, fullName))
+	return err
+}
+
+// SaveBookSnapshot records the sorted buy and sell ladders at the close of
+// epoch (epochIdx, epochDur) for market mktSchema. The matcher does not
+// call it, so a book_snapshots row exists only for epochs a caller has
+// saved with it.
+func SaveBookSnapshot(db txOrDB, mktSchema string, epochIdx, epochDur uint64, buys, sells []BookPoint) error {
+	fullName := mktSchema + "." + bookSnapshotsTableName
+	stmt := fmt.Sprintf(insertBookSnapshotStmt, fullName)
+	_, err := db.Exec(stmt, epochIdx, epochDur, encodeLadder(buys), encodeLadder(sells))
+	return err
+}
+
+// BookSnapshot retrieves the buy and sell ladders recorded for epoch
+// (epochIdx, epochDur) in market mktSchema, as saved by SaveBookSnapshot.
+func BookSnapshot(db txOrDB, mktSchema string, epochIdx, epochDur uint64) (buys, sells []BookPoint, err error) {
+	fullName := mktSchema + "." + bookSnapshotsTableName
+	stmt := fmt.Sprintf(selectBookSnapshotStmt, fullName)
+	var buysRaw, sellsRaw []byte
+	if err = db.QueryRow(stmt, epochIdx, epochDur).Scan(&buysRaw, &sellsRaw); err != nil {
+		return nil, nil, err
+	}
+	if buys, err = decodeLadder(buysRaw); err != nil {
+		return nil, nil, err
+	}
+	if sells, err = decodeLadder(sellsRaw); err != nil {
+		return nil, nil, err
+	}
+	return buys, sells, nil
+}
@@ -0,0 +1,235 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package pg
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Resolution identifies one of the fixed candle bucket widths maintained
+// per market. The table suffix doubles as the value stored in API
+// responses, so it must not change once released.
+type Resolution struct {
+	Suffix string
+	Bucket time.Duration
+}
+
+// Resolutions are the fixed candle widths every market maintains, from
+// finest to coarsest.
+var Resolutions = []Resolution{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+	{"1h", time.Hour},
+	{"4h", 4 * time.Hour},
+	{"1d", 24 * time.Hour},
+}
+
+// candlesTableName returns the per-resolution table name, e.g. "candles_1m".
+func candlesTableName(res Resolution) string {
+	return "candles_" + res.Suffix
+}
+
+// bucketStart floors t to the start of its res bucket, in milliseconds
+// since the Unix epoch.
+func bucketStart(res Resolution, t time.Time) int64 {
+	ms := t.UnixMilli()
+	width := res.Bucket.Milliseconds()
+	return ms - ms%width
+}
+
+const createCandlesTableStmt = `CREATE TABLE IF NOT EXISTS %s (
+	bucket_start INT8 PRIMARY KEY,
+	base_vol INT8,
+	quote_vol INT8,
+	open INT8,
+	high INT8,
+	low INT8,
+	close INT8,
+	match_count INT8
+);`
+
+// Candle is a single OHLCV bucket.
+type Candle struct {
+	BucketStart int64
+	BaseVol     uint64
+	QuoteVol    uint64
+	Open        uint64
+	High        uint64
+	Low         uint64
+	Close       uint64
+	MatchCount  uint64
+}
+
+// createCandlesTables creates the per-resolution candle tables for
+// mktSchema, if they do not already exist.
+func createCandlesTables(db txOrDB, mktSchema string) error {
+	for _, res := range Resolutions {
+		fullName := mktSchema + "." + candlesTableName(res)
+		if _, err := db.Exec(fmt.Sprintf(createCandlesTableStmt, fullName)); err != nil {
+			return fmt.Errorf("failed to create %s: %w", fullName, err)
+		}
+	}
+	return nil
+}
+
+// upsertCandleStmt inserts a new bucket or folds (rate, qty) into an
+// existing one: volumes and match_count accumulate, open is set only on
+// insert (first trade in the bucket), high/low widen, and close is always
+// overwritten since $4 is the rate of the most recent trade seen for this
+// bucket.
+const upsertCandleStmt = `INSERT INTO %s (bucket_start, base_vol, quote_vol, open, high, low, close, match_count)
+	VALUES ($1, $2, $3, $4, $4, $4, $4, 1)
+	ON CONFLICT (bucket_start) DO UPDATE SET
+		base_vol = %[1]s.base_vol + $2,
+		quote_vol = %[1]s.quote_vol + $3,
+		high = GREATEST(%[1]s.high, $4),
+		low = LEAST(%[1]s.low, $4),
+		close = $4,
+		match_count = %[1]s.match_count + 1;`
+
+// recordMatch folds one match (rate, base quantity, quote quantity, time)
+// into the candle bucket it falls into for every resolution.
+func recordMatch(db txOrDB, mktSchema string, rate, baseQty, quoteQty uint64, matchTime time.Time) error {
+	for _, res := range Resolutions {
+		fullName := mktSchema + "." + candlesTableName(res)
+		stmt := fmt.Sprintf(upsertCandleStmt, fullName)
+		_, err := db.Exec(stmt, bucketStart(res, matchTime), baseQty, quoteQty, rate)
+		if err != nil {
+			return fmt.Errorf("failed to upsert %s candle: %w", fullName, err)
+		}
+	}
+	return nil
+}
+
+const selectCandlesStmt = `SELECT bucket_start, base_vol, quote_vol, open, high, low, close, match_count
+	FROM %s WHERE bucket_start >= $1 AND bucket_start < $2 ORDER BY bucket_start;`
+
+// CandleHistory retrieves the candles for mktSchema at the given
+// resolution, covering bucket start times in [from, to). It is a package
+// function only: the pg Archiver has no CandleHistory or BookSnapshot
+// method, and the server/db.DEXArchivist interface does not include one.
+func CandleHistory(db txOrDB, mktSchema string, res Resolution, from, to time.Time) ([]Candle, error) {
+	fullName := mktSchema + "." + candlesTableName(res)
+	rows, err := db.Query(fmt.Sprintf(selectCandlesStmt, fullName), from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candles []Candle
+	for rows.Next() {
+		var c Candle
+		if err := rows.Scan(&c.BucketStart, &c.BaseVol, &c.QuoteVol, &c.Open, &c.High, &c.Low, &c.Close, &c.MatchCount); err != nil {
+			return nil, err
+		}
+		candles = append(candles, c)
+	}
+	return candles, rows.Err()
+}
+
+// maxBucketStart returns the latest bucket_start recorded for mktSchema at
+// res, and whether the table had any rows at all. It is how
+// MarketStatsProcessor.Bootstrap finds the gap to replay on startup.
+func maxBucketStart(db txOrDB, mktSchema string, res Resolution) (bucket int64, found bool, err error) {
+	fullName := mktSchema + "." + candlesTableName(res)
+	var max sql.NullInt64
+	row := db.QueryRow(fmt.Sprintf(`SELECT MAX(bucket_start) FROM %s;`, fullName))
+	if err := row.Scan(&max); err != nil {
+		return 0, false, err
+	}
+	return max.Int64, max.Valid, nil
+}
+
+// MarketStatsProcessor incrementally maintains a single market's candle
+// tables as matches settle, the same "processor watches storage" role
+// SaveBookSnapshot plays for book depth. It is fed only through
+// RecordMatch, which the matcher does not call; it does not subscribe to
+// the LISTEN/NOTIFY fanout in notify.go.
+type MarketStatsProcessor struct {
+	db        *sql.DB
+	mktSchema string
+}
+
+// NewMarketStatsProcessor creates a processor for the given market schema.
+// The candle tables are assumed to already exist (v4Upgrade creates them
+// for every known market; CreateMarket should do the same for a market
+// added afterward).
+func NewMarketStatsProcessor(db *sql.DB, mktSchema string) *MarketStatsProcessor {
+	return &MarketStatsProcessor{db: db, mktSchema: mktSchema}
+}
+
+// RecordMatch folds a newly settled match into every resolution's current
+// bucket.
+func (p *MarketStatsProcessor) RecordMatch(rate, baseQty, quoteQty uint64, matchTime time.Time) error {
+	return recordMatch(p.db, p.mktSchema, rate, baseQty, quoteQty, matchTime)
+}
+
+// Bootstrap replays epoch_reports into any resolution whose candle table is
+// missing buckets newer than its last recorded one, e.g. after downtime.
+func (p *MarketStatsProcessor) Bootstrap() error {
+	return backfillCandles(p.db, p.mktSchema)
+}
+
+// backfillCandles replays epoch_reports into any resolution whose candle
+// table is missing buckets newer than its last recorded one. It
+// approximates each missing epoch as a single trade at the epoch's end rate
+// for the epoch's full matched volume, the same granularity v2Upgrade's
+// historical backfill settles for in the absence of per-match records going
+// back further than epoch_reports retains. v4Upgrade and
+// MarketStatsProcessor.Bootstrap share this so the one-shot upgrade backfill
+// and the startup gap-replay can't drift apart.
+func backfillCandles(tx txOrDB, mktSchema string) error {
+	fullEpochReportsTableName := mktSchema + "." + epochReportsTableName
+	for _, res := range Resolutions {
+		last, found, err := maxBucketStart(tx, mktSchema, res)
+		if err != nil {
+			return fmt.Errorf("failed to read last %s bucket for %s: %w", res.Suffix, mktSchema, err)
+		}
+		var rows *sql.Rows
+		if found {
+			// last is the start of the newest bucket already recorded at
+			// this resolution, and an epoch is bucketed by its end time
+			// (epoch_idx+1)*epoch_dur (see epochEnd below). Only epochs
+			// ending at or after the next bucket's start are replayed, so
+			// the trades already in bucket last are not folded in twice.
+			rows, err = tx.Query(fmt.Sprintf(`SELECT epoch_idx, epoch_dur, match_vol, quote_vol, end_rate
+				FROM %s WHERE (epoch_idx + 1) * epoch_dur >= $1 ORDER BY epoch_idx;`, fullEpochReportsTableName),
+				last+res.Bucket.Milliseconds())
+		} else {
+			rows, err = tx.Query(fmt.Sprintf(`SELECT epoch_idx, epoch_dur, match_vol, quote_vol, end_rate
+				FROM %s ORDER BY epoch_idx;`, fullEpochReportsTableName))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s for %s replay: %w", epochReportsTableName, mktSchema, err)
+		}
+
+		var replayed int
+		for rows.Next() {
+			var epochIdx, epochDur, matchVol, quoteVol, endRate uint64
+			if err := rows.Scan(&epochIdx, &epochDur, &matchVol, &quoteVol, &endRate); err != nil {
+				rows.Close()
+				return err
+			}
+			if matchVol == 0 {
+				continue // no trades in this epoch, nothing to fold in
+			}
+			epochEnd := time.UnixMilli(int64((epochIdx + 1) * epochDur))
+			if err := recordMatch(tx, mktSchema, endRate, matchVol, quoteVol, epochEnd); err != nil {
+				rows.Close()
+				return err
+			}
+			replayed++
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return err
+		}
+		rows.Close()
+		log.Debugf("Replayed %d historical epochs into %s %s candles", replayed, mktSchema, res.Suffix)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+// This code is available on the terms of the project LICENSE.md file,
+// also available online at https://blueoakcouncil.org/license/1.0.0.
+
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// matchNotifyChannelPrefix and epochNotifyChannelPrefix name the pg_notify
+// channels the notify_match/notify_epoch triggers installed by v5Upgrade
+// fire on, one pair per market.
+const (
+	matchNotifyChannelPrefix = "dex_matches_"
+	epochNotifyChannelPrefix = "dex_epochs_"
+)
+
+// matchNotifyChannel and epochNotifyChannel name the channel for a given
+// market schema, matching what the triggers in v5Upgrade pg_notify to.
+func matchNotifyChannel(mktSchema string) string { return matchNotifyChannelPrefix + mktSchema }
+func epochNotifyChannel(mktSchema string) string { return epochNotifyChannelPrefix + mktSchema }
+
+// MatchEvent is the payload fired on matchNotifyChannel(mktSchema) by the
+// notify_match trigger for every row inserted into <mktSchema>.matches. It
+// carries enough to reconstruct the trade without a follow-up SELECT; quote
+// volume is left to the subscriber to derive via dex/calc.BaseToQuote(Rate,
+// BaseQty), same as the rest of the pg driver does.
+type MatchEvent struct {
+	EpochIdx  uint64 `json:"epoch_idx"`
+	EpochDur  uint64 `json:"epoch_dur"`
+	Rate      uint64 `json:"rate"`
+	BaseQty   uint64 `json:"base_qty"`
+	TakerSell bool   `json:"taker_sell"`
+}
+
+// EpochEvent is the payload fired on epochNotifyChannel(mktSchema) by the
+// notify_epoch trigger for every row inserted into
+// <mktSchema>.epoch_reports.
+type EpochEvent struct {
+	EpochIdx  uint64 `json:"epoch_idx"`
+	EpochDur  uint64 `json:"epoch_dur"`
+	MatchVol  uint64 `json:"match_vol"`
+	QuoteVol  uint64 `json:"quote_vol"`
+	HighRate  uint64 `json:"high_rate"`
+	LowRate   uint64 `json:"low_rate"`
+	StartRate uint64 `json:"start_rate"`
+	EndRate   uint64 `json:"end_rate"`
+}
+
+// Event is a single decoded notification delivered by Subscribe. Exactly
+// one of Match or Epoch is set, matching the channel Subscribe was asked
+// for.
+type Event struct {
+	Channel string
+	Match   *MatchEvent
+	Epoch   *EpochEvent
+}
+
+// epochIdx reports the epoch_idx carried by whichever of Match or Epoch is
+// set, used to track how far a subscription has progressed for gap replay.
+func (ev Event) epochIdx() (uint64, bool) {
+	switch {
+	case ev.Match != nil:
+		return ev.Match.EpochIdx, true
+	case ev.Epoch != nil:
+		return ev.Epoch.EpochIdx, true
+	default:
+		return 0, false
+	}
+}
+
+const (
+	notifyReconnectMinInterval = 10 * time.Second
+	notifyReconnectMaxInterval = time.Minute
+)
+
+// Subscribe LISTENs on channel (a matchNotifyChannel or epochNotifyChannel
+// value) over a dedicated connection — LISTEN/NOTIFY is session-scoped, so
+// it cannot share db's pooled connections — and streams decoded Events
+// until ctx is cancelled. The returned channel is closed when the
+// subscription ends, whether from ctx cancellation or an unrecoverable
+// listener error.
+//
+// pq.Listener reconnects on its own after a dropped connection, but any
+// NOTIFY fired during the gap between disconnect and reconnect is lost to
+// LISTEN/NOTIFY's at-most-once delivery. Subscribe closes that gap itself:
+// it remembers the highest epoch_idx seen on channel and, on reconnect,
+// replays rows for mktSchema from the backing table before resuming live
+// delivery, so a consumer never silently skips an epoch because of a
+// dropped connection.
+//
+// On epochNotifyChannel this is exactly-once: epoch_reports has one row
+// per epoch_idx, so replaying strictly newer rows can't reintroduce
+// anything already delivered. On matchNotifyChannel it is only
+// at-least-once: matches has many rows per epoch_idx, so if the
+// connection drops partway through an epoch's matches, the replay
+// re-requests that whole epoch_idx (not just strictly newer ones) to
+// avoid losing the remaining rows, which can redeliver a handful of
+// matches the consumer already saw. A match consumer should treat
+// MatchEvent delivery as idempotent rather than assume exactly-once.
+func Subscribe(ctx context.Context, db *sql.DB, connString, mktSchema, channel string) (<-chan Event, error) {
+	events := make(chan Event, 64)
+
+	listener := pq.NewListener(connString, notifyReconnectMinInterval, notifyReconnectMaxInterval,
+		func(ev pq.ListenerEventType, err error) {
+			switch ev {
+			case pq.ListenerEventDisconnected:
+				log.Warnf("Subscribe(%s): connection lost: %v", channel, err)
+			case pq.ListenerEventReconnected:
+				log.Infof("Subscribe(%s): reconnected", channel)
+			case pq.ListenerEventConnectionAttemptFailed:
+				log.Warnf("Subscribe(%s): reconnect attempt failed: %v", channel, err)
+			}
+		})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+
+	go func() {
+		defer close(events)
+		defer listener.Close()
+
+		var lastEpochIdx uint64
+		var haveLast bool
+
+		deliver := func(ev Event) bool {
+			if idx, ok := ev.epochIdx(); ok {
+				lastEpochIdx, haveLast = idx, true
+			}
+			select {
+			case events <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		replayGap := func() {
+			if !haveLast {
+				return // nothing delivered yet; nothing to catch up on
+			}
+			missed, err := replayMissedEvents(db, mktSchema, channel, lastEpochIdx)
+			if err != nil {
+				log.Errorf("Subscribe(%s): gap replay failed: %v", channel, err)
+				return
+			}
+			for _, ev := range missed {
+				if !deliver(ev) {
+					return
+				}
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case n, ok := <-listener.Notify:
+				if !ok {
+					return
+				}
+				if n == nil {
+					// A nil notification marks a reconnect; pq.Listener has
+					// already re-issued LISTEN for us by this point.
+					replayGap()
+					continue
+				}
+				ev, err := decodeEvent(n.Channel, []byte(n.Extra))
+				if err != nil {
+					log.Errorf("Subscribe(%s): bad notification payload: %v", channel, err)
+					continue
+				}
+				if !deliver(ev) {
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// decodeEvent unmarshals a raw pg_notify payload according to which kind of
+// channel it arrived on.
+func decodeEvent(channel string, payload []byte) (Event, error) {
+	switch {
+	case strings.HasPrefix(channel, matchNotifyChannelPrefix):
+		var m MatchEvent
+		if err := json.Unmarshal(payload, &m); err != nil {
+			return Event{}, fmt.Errorf("decoding match event: %w", err)
+		}
+		return Event{Channel: channel, Match: &m}, nil
+	case strings.HasPrefix(channel, epochNotifyChannelPrefix):
+		var e EpochEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return Event{}, fmt.Errorf("decoding epoch event: %w", err)
+		}
+		return Event{Channel: channel, Epoch: &e}, nil
+	default:
+		return Event{}, fmt.Errorf("unrecognized notify channel %q", channel)
+	}
+}
+
+// replayMissedEvents reads every row for mktSchema with an epoch_idx
+// greater than lastEpochIdx from the table backing channel, in the same
+// shape as the live notifications they substitute for.
+func replayMissedEvents(db *sql.DB, mktSchema, channel string, lastEpochIdx uint64) ([]Event, error) {
+	switch {
+	case strings.HasPrefix(channel, matchNotifyChannelPrefix):
+		return replayMatchEvents(db, mktSchema, lastEpochIdx)
+	case strings.HasPrefix(channel, epochNotifyChannelPrefix):
+		return replayEpochEvents(db, mktSchema, lastEpochIdx)
+	default:
+		return nil, fmt.Errorf("unrecognized notify channel %q", channel)
+	}
+}
+
+// replayMatchEvents re-requests lastEpochIdx's own matches in addition to
+// everything newer, since the matches table has many rows per epoch_idx
+// and a dropped connection may have interrupted delivery partway through
+// that epoch. This can redeliver a match already seen before the drop; see
+// Subscribe's doc comment.
+func replayMatchEvents(db *sql.DB, mktSchema string, lastEpochIdx uint64) ([]Event, error) {
+	fullMatchesTableName := mktSchema + "." + matchesTableName
+	rows, err := db.Query(fmt.Sprintf(`SELECT epochidx, epochdur, rate, quantity, takersell
+		FROM %s WHERE epochidx >= $1 ORDER BY epochidx;`, fullMatchesTableName), lastEpochIdx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var m MatchEvent
+		if err := rows.Scan(&m.EpochIdx, &m.EpochDur, &m.Rate, &m.BaseQty, &m.TakerSell); err != nil {
+			return nil, err
+		}
+		events = append(events, Event{Channel: matchNotifyChannel(mktSchema), Match: &m})
+	}
+	return events, rows.Err()
+}
+
+func replayEpochEvents(db *sql.DB, mktSchema string, lastEpochIdx uint64) ([]Event, error) {
+	fullEpochReportsTableName := mktSchema + "." + epochReportsTableName
+	rows, err := db.Query(fmt.Sprintf(`SELECT epoch_idx, epoch_dur, match_vol, quote_vol, high_rate, low_rate, start_rate, end_rate
+		FROM %s WHERE epoch_idx > $1 ORDER BY epoch_idx;`, fullEpochReportsTableName), lastEpochIdx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e EpochEvent
+		if err := rows.Scan(&e.EpochIdx, &e.EpochDur, &e.MatchVol, &e.QuoteVol, &e.HighRate, &e.LowRate, &e.StartRate, &e.EndRate); err != nil {
+			return nil, err
+		}
+		events = append(events, Event{Channel: epochNotifyChannel(mktSchema), Epoch: &e})
+	}
+	return events, rows.Err()
+}
@@ -4,6 +4,7 @@
 package pg
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"math"
@@ -15,10 +16,33 @@ import (
 	"decred.org/dcrdex/server/db/driver/pg/internal"
 )
 
-const dbVersion = 2
+const dbVersion = 5
+
+// txOrDB is satisfied by both *sql.DB and *sql.Tx. Upgrade and downgrade
+// steps are written against it so that upgradeDB and MigrateTo can run each
+// one inside its own transaction alongside the meta.schema_version update,
+// while helpers like DBVersion that are also used outside a migration can
+// keep taking a bare *sql.DB.
+type txOrDB interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// ProgressFunc reports how far a migration step has gotten, in whatever
+// unit that step counts in (epochs for v2Upgrade's backfill, markets for
+// most others). PlanUpgrades does not use it; its estimates are row counts
+// (see MarketUpgradePlan).
+type ProgressFunc func(processed, total int)
+
+// noProgress discards progress reports, for callers that don't have an
+// operator watching (e.g. tests).
+func noProgress(int, int) {}
 
-// The number of upgrades defined MUST be equal to dbVersion.
-var upgrades = []func(db *sql.DB) error{
+// The number of upgrades defined MUST be equal to dbVersion, and downgrades
+// MUST be the exact reverse: downgrades[i] undoes whatever upgrades[i] did.
+var upgrades = []func(ctx context.Context, tx txOrDB, progress ProgressFunc) error{
 	// v1 upgrade adds the schema_version column to the meta table, possibly
 	// creating the table if it was missing.
 	v1Upgrade,
@@ -30,22 +54,51 @@ var upgrades = []func(db *sql.DB) error{
 	// book_sells* columns since this data requires a book snapshot at the time
 	// of matching to generate.
 	v2Upgrade,
+
+	// v3 upgrade creates the book_snapshots table that SaveBookSnapshot
+	// writes to; the matcher does not call SaveBookSnapshot.
+	// epoch_reports.book_buys/book_sells cannot be backfilled for epochs
+	// that predate this upgrade, since this schema never persisted
+	// resting-order/cancel state to reconstruct historical book depth
+	// from; those rows keep a zero book depth.
+	v3Upgrade,
+
+	// v4 upgrade creates the per-resolution candle tables MarketStatsProcessor
+	// writes to, and backfills them from epoch_reports at the
+	// coarse per-epoch granularity described on MarketStatsProcessor.Bootstrap.
+	v4Upgrade,
+
+	// v5 upgrade installs the notify_match/notify_epoch trigger functions
+	// that pg_notify every row inserted into matches/epoch_reports, so
+	// Subscribe can stream market activity without polling.
+	v5Upgrade,
+}
+
+// downgrades reverses the corresponding entry in upgrades. Historical data
+// backfilled by an upgrade (e.g. v2Upgrade's epoch_reports rows) is lost on
+// downgrade; only the schema changes are guaranteed to be undone.
+var downgrades = []func(ctx context.Context, tx txOrDB, progress ProgressFunc) error{
+	downV1,
+	downV2,
+	downV3,
+	downV4,
+	downV5,
 }
 
 // v1Upgrade adds the schema_version column and removes the state_hash column
 // from the meta table.
-func v1Upgrade(db *sql.DB) error {
+func v1Upgrade(_ context.Context, tx txOrDB, progress ProgressFunc) error {
 	// Create the meta table with the v0 scheme. Even if the table does not
 	// exists, we should not create it fresh with the current scheme since one
 	// or more subsequent upgrades may alter the meta scheme.
 	metaV0Stmt := `CREATE TABLE IF NOT EXISTS %s (state_hash BYTEA)`
-	metaCreated, err := createTable(db, metaV0Stmt, publicSchema, metaTableName)
+	metaCreated, err := createTable(tx, metaV0Stmt, publicSchema, metaTableName)
 	if err != nil {
 		return fmt.Errorf("failed to create meta table: %w", err)
 	}
 	if metaCreated {
 		log.Infof("Created new %q table", metaTableName)    // from 0.2+pre master
-		_, err = db.Exec(`INSERT INTO meta DEFAULT VALUES`) // might be CreateMetaRow, but ping to v0 stmt
+		_, err = tx.Exec(`INSERT INTO meta DEFAULT VALUES`) // might be CreateMetaRow, but ping to v0 stmt
 		if err != nil {
 			return fmt.Errorf("failed to create row for meta table: %w", err)
 		}
@@ -54,11 +107,24 @@ func v1Upgrade(db *sql.DB) error {
 	}
 
 	// Create the schema_version column. The caller must set the version to 1.
-	_, err = db.Exec(`ALTER TABLE ` + metaTableName + ` ADD COLUMN IF NOT EXISTS schema_version INT4 DEFAULT 0;`)
+	_, err = tx.Exec(`ALTER TABLE ` + metaTableName + ` ADD COLUMN IF NOT EXISTS schema_version INT4 DEFAULT 0;`)
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(`ALTER TABLE ` + metaTableName + ` DROP COLUMN IF EXISTS state_hash;`)
+	_, err = tx.Exec(`ALTER TABLE ` + metaTableName + ` DROP COLUMN IF EXISTS state_hash;`)
+	return err
+}
+
+// downV1 reverses v1Upgrade: it restores the state_hash column (empty, since
+// the original values were never retained) and drops schema_version. The
+// meta table row itself, if v1Upgrade created it, is left in place since a
+// v0 database only ever expects the table to exist with one row.
+func downV1(_ context.Context, tx txOrDB, _ ProgressFunc) error {
+	_, err := tx.Exec(`ALTER TABLE ` + metaTableName + ` ADD COLUMN IF NOT EXISTS state_hash BYTEA;`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`ALTER TABLE ` + metaTableName + ` DROP COLUMN IF EXISTS schema_version;`)
 	return err
 }
 
@@ -91,22 +157,27 @@ func matchStatsForMarketEpoch(stmt *sql.Stmt, epochIdx, epochDur uint64) (rates,
 }
 
 // v2Upgrade populates the epoch_reports table with historical data from the
-// matches table.
-func v2Upgrade(db *sql.DB) error {
-	mkts, err := loadMarkets(db, marketsTableName)
+// matches table. Every statement below runs against the tx the caller
+// (upgradeDB or MigrateTo) opened, never the bare connection, so a failure
+// partway through rolls back cleanly instead of leaving the temporary match
+// index or a half-populated epoch_reports table behind.
+//
+// This is the longest-running upgrade in the chain — it scans every
+// historical epoch across every market — so it's the one that actually
+// checks ctx for cancellation and calls progress with meaningful
+// [processed/total] counts; see PlanUpgrades for estimating that total and
+// its throughput ahead of time.
+func v2Upgrade(ctx context.Context, tx txOrDB, progress ProgressFunc) error {
+	mkts, err := loadMarkets(tx, marketsTableName)
 	if err != nil {
 		return fmt.Errorf("failed to read markets table: %w", err)
 	}
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
 
 	doMarketMatches := func(mkt *dex.MarketInfo) error {
 		log.Infof("Populating %s with volume data for market %q matches...", epochsTableName, mkt.Name)
 
 		// Create the epochs_report table if it does not already exist.
-		_, err := CreateTable(db, mkt.Name, epochReportsTableName)
+		_, err := CreateTable(tx, mkt.Name, epochReportsTableName)
 		if err != nil {
 			return err
 		}
@@ -125,7 +196,6 @@ func v2Upgrade(db *sql.DB) error {
 		for rows.Next() {
 			var dur, first, last uint64
 			if err = rows.Scan(&dur, &first, &last); err != nil {
-				_ = tx.Rollback()
 				return err
 			}
 			durs = append(durs, dur)
@@ -140,7 +210,7 @@ func v2Upgrade(db *sql.DB) error {
 		// epoch_reports INSERT statement
 		mktEpochReportsTablename := mkt.Name + "." + epochReportsTableName
 		reportStmt := fmt.Sprintf(internal.InsertPartialEpochReport, mktEpochReportsTablename)
-		reportStmtPrep, err := db.Prepare(reportStmt)
+		reportStmtPrep, err := tx.Prepare(reportStmt)
 		if err != nil {
 			return err
 		}
@@ -149,42 +219,49 @@ func v2Upgrade(db *sql.DB) error {
 		// Create a temporary matches index on (epochidx, epochdur).
 		fullMatchesTableName := mkt.Name + "." + matchesTableName
 		matchIndexName := "matches_epidxdur_temp_idx"
-		_, err = db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (epochidx, epochdur);",
+		_, err = tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (epochidx, epochdur);",
 			matchIndexName, fullMatchesTableName))
 		if err != nil {
 			return err
 		}
 		defer func() {
-			_, err = db.Exec(fmt.Sprintf("DROP INDEX %s;", mkt.Name+"."+matchIndexName))
+			_, err = tx.Exec(fmt.Sprintf("DROP INDEX %s;", mkt.Name+"."+matchIndexName))
 		}()
 
 		// matches(qty,rate,takerSell) SELECT statement
 		matchStatsStmt := fmt.Sprintf(internal.RetrieveMatchStatsByEpoch, fullMatchesTableName)
-		matchStatsStmtPrep, err := db.Prepare(matchStatsStmt)
+		matchStatsStmtPrep, err := tx.Prepare(matchStatsStmt)
 		if err != nil {
 			return err
 		}
 		defer matchStatsStmtPrep.Close()
 
+		var totalEpochs uint64
+		for i := range durs {
+			totalEpochs += ends[i] - starts[i] + 1
+		}
+
 		var startRate, endRate uint64
 		var totalMatches uint64
 		var totalVolume, totalQVolume uint64
+		var processed uint64
 		for i, dur := range durs {
 			log.Infof("Processing all %d of the %d ms %q epochs from idx %d to %d...",
 				ends[i]-starts[i]+1, dur, mkt.Name, starts[i], ends[i])
 			endIdx := ends[i]
 			for idx := starts[i]; idx <= endIdx; idx++ {
-				if idx%50000 == 0 {
-					to := idx + 50000
-					if to > endIdx+1 {
-						to = endIdx + 1
-					}
-					log.Infof(" - Processing epochs [%d, %d)...", idx, to)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				default:
 				}
+
 				rates, quantities, _, err := matchStatsForMarketEpoch(matchStatsStmtPrep, idx, dur)
 				if err != nil {
 					return err
 				}
+				processed++
+				progress(int(processed), int(totalEpochs))
 				epochEnd := (idx + 1) * dur
 				if len(rates) == 0 {
 					// No trade matches in this epoch.
@@ -239,13 +316,206 @@ func v2Upgrade(db *sql.DB) error {
 	}
 
 	for _, mkt := range mkts {
-		err = doMarketMatches(mkt)
-		if err != nil {
-			_ = tx.Rollback()
+		if err := doMarketMatches(mkt); err != nil {
 			return err
 		}
 	}
-	return tx.Commit()
+	return nil
+}
+
+// downV2 reverses v2Upgrade by dropping each market's epoch_reports table.
+// The historical volume/rate data it backfilled is not recoverable; a
+// subsequent re-upgrade to v2 rebuilds it from the matches table instead.
+func downV2(_ context.Context, tx txOrDB, _ ProgressFunc) error {
+	mkts, err := loadMarkets(tx, marketsTableName)
+	if err != nil {
+		return fmt.Errorf("failed to read markets table: %w", err)
+	}
+	for _, mkt := range mkts {
+		fullEpochReportsTableName := mkt.Name + "." + epochReportsTableName
+		if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, fullEpochReportsTableName)); err != nil {
+			return fmt.Errorf("failed to drop %s: %w", fullEpochReportsTableName, err)
+		}
+	}
+	return nil
+}
+
+// v3Upgrade creates the book_snapshots table for every market, the table
+// SaveBookSnapshot writes ladder snapshots to. The matcher does not call
+// SaveBookSnapshot, so the table holds only what a caller saves into it.
+//
+// epoch_reports.book_buys/book_sells is NOT backfilled for epochs that
+// predate this upgrade, and deliberately so: book depth at a historical
+// epoch's close is a function of every order still resting on the book at
+// that moment plus any cancels applied to it, and this schema only ever
+// persisted executed matches (see matchStatsForMarketEpoch) — it has no
+// record of resting or canceled orders to replay. There is no way to
+// reconstruct that depth from data this database actually has, so
+// historical rows keep whatever book_buys/book_sells they already had
+// (zero, same as before this upgrade) rather than backfill it from a
+// table this same migration just created empty.
+func v3Upgrade(ctx context.Context, tx txOrDB, progress ProgressFunc) error {
+	mkts, err := loadMarkets(tx, marketsTableName)
+	if err != nil {
+		return fmt.Errorf("failed to read markets table: %w", err)
+	}
+
+	for i, mkt := range mkts {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if err := createBookSnapshotsTable(tx, mkt.Name); err != nil {
+			return fmt.Errorf("failed to create %s.%s: %w", mkt.Name, bookSnapshotsTableName, err)
+		}
+		progress(i+1, len(mkts))
+	}
+	return nil
+}
+
+// downV3 reverses v3Upgrade by dropping each market's book_snapshots table.
+// epoch_reports is left as it is, since v3Upgrade does not modify it.
+func downV3(_ context.Context, tx txOrDB, _ ProgressFunc) error {
+	mkts, err := loadMarkets(tx, marketsTableName)
+	if err != nil {
+		return fmt.Errorf("failed to read markets table: %w", err)
+	}
+	for _, mkt := range mkts {
+		fullBookSnapshotsTableName := mkt.Name + "." + bookSnapshotsTableName
+		if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, fullBookSnapshotsTableName)); err != nil {
+			return fmt.Errorf("failed to drop %s: %w", fullBookSnapshotsTableName, err)
+		}
+	}
+	return nil
+}
+
+// v4Upgrade creates the per-resolution candle tables for every market and
+// backfills them from epoch_reports. Later matches reach these tables only
+// through MarketStatsProcessor.RecordMatch, which the matcher does not call.
+func v4Upgrade(ctx context.Context, tx txOrDB, progress ProgressFunc) error {
+	mkts, err := loadMarkets(tx, marketsTableName)
+	if err != nil {
+		return fmt.Errorf("failed to read markets table: %w", err)
+	}
+	for i, mkt := range mkts {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if err := createCandlesTables(tx, mkt.Name); err != nil {
+			return fmt.Errorf("failed to create candle tables for %s: %w", mkt.Name, err)
+		}
+		if err := backfillCandles(tx, mkt.Name); err != nil {
+			return fmt.Errorf("failed to backfill candles for %s: %w", mkt.Name, err)
+		}
+		progress(i+1, len(mkts))
+	}
+	return nil
+}
+
+// downV4 reverses v4Upgrade by dropping every market's candle tables.
+func downV4(_ context.Context, tx txOrDB, _ ProgressFunc) error {
+	mkts, err := loadMarkets(tx, marketsTableName)
+	if err != nil {
+		return fmt.Errorf("failed to read markets table: %w", err)
+	}
+	for _, mkt := range mkts {
+		for _, res := range Resolutions {
+			fullName := mkt.Name + "." + candlesTableName(res)
+			if _, err := tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s;`, fullName)); err != nil {
+				return fmt.Errorf("failed to drop %s: %w", fullName, err)
+			}
+		}
+	}
+	return nil
+}
+
+const createNotifyMatchTriggerStmt = `CREATE OR REPLACE FUNCTION %[1]s.notify_match() RETURNS TRIGGER AS $$
+BEGIN
+	PERFORM pg_notify('%[2]s', json_build_object(
+		'epoch_idx', NEW.epochidx,
+		'epoch_dur', NEW.epochdur,
+		'rate', NEW.rate,
+		'base_qty', NEW.quantity,
+		'taker_sell', NEW.takersell
+	)::text);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notify_match_trg ON %[1]s.matches;
+CREATE TRIGGER notify_match_trg AFTER INSERT ON %[1]s.matches
+	FOR EACH ROW EXECUTE FUNCTION %[1]s.notify_match();`
+
+const createNotifyEpochTriggerStmt = `CREATE OR REPLACE FUNCTION %[1]s.notify_epoch() RETURNS TRIGGER AS $$
+BEGIN
+	PERFORM pg_notify('%[2]s', json_build_object(
+		'epoch_idx', NEW.epoch_idx,
+		'epoch_dur', NEW.epoch_dur,
+		'match_vol', NEW.match_vol,
+		'quote_vol', NEW.quote_vol,
+		'high_rate', NEW.high_rate,
+		'low_rate', NEW.low_rate,
+		'start_rate', NEW.start_rate,
+		'end_rate', NEW.end_rate
+	)::text);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notify_epoch_trg ON %[1]s.epoch_reports;
+CREATE TRIGGER notify_epoch_trg AFTER INSERT ON %[1]s.epoch_reports
+	FOR EACH ROW EXECUTE FUNCTION %[1]s.notify_epoch();`
+
+const dropNotifyTriggersStmt = `DROP TRIGGER IF EXISTS notify_match_trg ON %[1]s.matches;
+DROP FUNCTION IF EXISTS %[1]s.notify_match();
+DROP TRIGGER IF EXISTS notify_epoch_trg ON %[1]s.epoch_reports;
+DROP FUNCTION IF EXISTS %[1]s.notify_epoch();`
+
+// v5Upgrade installs, for every market, the trigger functions that
+// pg_notify a JSON summary of each row inserted into matches and
+// epoch_reports — see notify.go's MatchEvent/EpochEvent for the decoded
+// shape and Subscribe for consuming them.
+func v5Upgrade(ctx context.Context, tx txOrDB, progress ProgressFunc) error {
+	mkts, err := loadMarkets(tx, marketsTableName)
+	if err != nil {
+		return fmt.Errorf("failed to read markets table: %w", err)
+	}
+	for i, mkt := range mkts {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf(createNotifyMatchTriggerStmt, mkt.Name, matchNotifyChannel(mkt.Name))); err != nil {
+			return fmt.Errorf("failed to install match notify trigger for %s: %w", mkt.Name, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(createNotifyEpochTriggerStmt, mkt.Name, epochNotifyChannel(mkt.Name))); err != nil {
+			return fmt.Errorf("failed to install epoch notify trigger for %s: %w", mkt.Name, err)
+		}
+		progress(i+1, len(mkts))
+	}
+	return nil
+}
+
+// downV5 reverses v5Upgrade by dropping the notify triggers and their
+// backing functions for every market.
+func downV5(_ context.Context, tx txOrDB, _ ProgressFunc) error {
+	mkts, err := loadMarkets(tx, marketsTableName)
+	if err != nil {
+		return fmt.Errorf("failed to read markets table: %w", err)
+	}
+	for _, mkt := range mkts {
+		if _, err := tx.Exec(fmt.Sprintf(dropNotifyTriggersStmt, mkt.Name)); err != nil {
+			return fmt.Errorf("failed to drop notify triggers for %s: %w", mkt.Name, err)
+		}
+	}
+	return nil
 }
 
 // DBVersion retrieves the database version from the meta table.
@@ -254,7 +524,7 @@ func DBVersion(db *sql.DB) (ver uint32, err error) {
 	return
 }
 
-func setDBVersion(db *sql.DB, ver uint32) error {
+func setDBVersion(db txOrDB, ver uint32) error {
 	res, err := db.Exec(internal.SetDBVersion, ver)
 	if err != nil {
 		return err
@@ -270,27 +540,32 @@ func setDBVersion(db *sql.DB, ver uint32) error {
 	return nil
 }
 
-func upgradeDB(db *sql.DB) error {
-	// Get the DB version from the meta table. Nonexistent meta table or
-	// meta.schema_version column implies v0, the upgrade from which adds the
-	// table and schema_version column.
-	var current uint32
+// currentDBVersion determines the schema version in effect, where a
+// nonexistent meta table or meta.schema_version column implies v0, the
+// version the v1 upgrade adds them from.
+func currentDBVersion(db *sql.DB) (uint32, error) {
 	found, err := tableExists(db, metaTableName)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if !found {
+		return 0, nil // v1 upgrade creates meta table
+	}
+	found, err = columnExists(db, "public", metaTableName, "schema_version")
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, nil // v1 upgrade creates meta.schema_version column
+	}
+	return DBVersion(db)
+}
+
+func upgradeDB(ctx context.Context, db *sql.DB) error {
+	current, err := currentDBVersion(db)
+	if err != nil {
+		return fmt.Errorf("failed to get DB version: %w", err)
 	}
-	if found {
-		found, err = columnExists(db, "public", metaTableName, "schema_version")
-		if err != nil {
-			return err
-		}
-		if found {
-			current, err = DBVersion(db)
-			if err != nil {
-				return fmt.Errorf("failed to get DB version: %w", err)
-			}
-		} // else v1 upgrade creates meta.schema_version column
-	} // else v1 upgrade creates meta table
 
 	if current == dbVersion {
 		log.Infof("DCRDEX database ready at version %d", dbVersion)
@@ -302,17 +577,8 @@ func upgradeDB(db *sql.DB) error {
 			current, dbVersion)
 	}
 
-	log.Infof("Upgrading DB scheme from %d to %d", current, len(upgrades))
-	for i, up := range upgrades[current:] {
-		targetVer := current + uint32(i) + 1
-		log.Debugf("Upgrading DB scheme to %d...", targetVer)
-		if err = up(db); err != nil {
-			return fmt.Errorf("failed to upgrade to db version %d: %w", targetVer, err)
-		}
-
-		if err = setDBVersion(db, targetVer); err != nil {
-			return fmt.Errorf("failed to set new DB version %d: %w", targetVer, err)
-		}
+	if err := MigrateTo(ctx, db, dbVersion, nil); err != nil {
+		return err
 	}
 
 	current, err = DBVersion(db)
@@ -322,3 +588,89 @@ func upgradeDB(db *sql.DB) error {
 	log.Infof("Upgrades complete. DB is at version %d", current)
 	return nil
 }
+
+// MigrateTo migrates the database to targetVer, walking the upgrades chain
+// forward or the downgrades chain backward from the current version as
+// needed. Each individual step runs in its own transaction together with
+// the meta.schema_version update, so a failure partway through a step never
+// leaves the schema and the recorded version out of sync; prior
+// successfully-applied steps remain committed.
+//
+// ctx is checked for cancellation between (and within the longer-running)
+// steps; a cancelled migration stops after the in-flight step's transaction
+// resolves, never partway through one. progress, if non-nil, is passed to
+// each step; the v2 through v5 upgrades invoke it with their own
+// [processed, total] counts, while v1Upgrade and the downgrades do not call
+// it. Pass nil to fall back to the steps' ordinary logging.
+//
+// This is the function an operator-facing --db-target-version server flag
+// should call to roll the schema forward to a specific release or back to
+// the version a prior release expects, rather than always migrating to the
+// latest dbVersion as upgradeDB does at startup.
+func MigrateTo(ctx context.Context, db *sql.DB, targetVer uint32, progress ProgressFunc) error {
+	if targetVer > dbVersion {
+		return fmt.Errorf("target DB version %d is newer than highest recognized version %d",
+			targetVer, dbVersion)
+	}
+	if progress == nil {
+		progress = noProgress
+	}
+
+	current, err := currentDBVersion(db)
+	if err != nil {
+		return fmt.Errorf("failed to get DB version: %w", err)
+	}
+
+	if current == targetVer {
+		log.Infof("DCRDEX database already at version %d", targetVer)
+		return nil
+	}
+
+	if current < targetVer {
+		log.Infof("Upgrading DB scheme from %d to %d", current, targetVer)
+		for ver := current; ver < targetVer; ver++ {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := runMigrationStep(ctx, db, upgrades[ver], ver+1, progress); err != nil {
+				return fmt.Errorf("failed to upgrade to db version %d: %w", ver+1, err)
+			}
+		}
+		return nil
+	}
+
+	log.Infof("Downgrading DB scheme from %d to %d", current, targetVer)
+	for ver := current; ver > targetVer; ver-- {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := runMigrationStep(ctx, db, downgrades[ver-1], ver-1, progress); err != nil {
+			return fmt.Errorf("failed to downgrade to db version %d: %w", ver-1, err)
+		}
+	}
+	return nil
+}
+
+// runMigrationStep runs step inside a single transaction, setting
+// meta.schema_version to newVer before committing. For newVer 0 there is no
+// version to set, since downV1 drops the schema_version column and its
+// absence is what marks v0. If step or the version update fails, the
+// transaction is rolled back and neither change applies.
+func runMigrationStep(ctx context.Context, db *sql.DB, step func(ctx context.Context, tx txOrDB, progress ProgressFunc) error, newVer uint32, progress ProgressFunc) error {
+	log.Debugf("Migrating DB scheme to %d...", newVer)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := step(ctx, tx, progress); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if newVer > 0 {
+		if err := setDBVersion(tx, newVer); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}